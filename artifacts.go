@@ -0,0 +1,153 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/docker"
+)
+
+var ArtifactDir = flag.String("test.artifact-dir", ".",
+	"directory of failure artifact tarballs, \"\" to disable")
+
+// artifactStep collects an artifact bundle if the wrapped step fails. This
+// is deferred so that it's also run after t.Fatal and, being a step, it's
+// before the docket tears down the containers.
+type artifactStep struct {
+	test.Tester
+	docket *docker.Docket
+}
+
+func (step artifactStep) Test(t *testing.T) {
+	defer func() {
+		if t.Failed() && len(*ArtifactDir) > 0 {
+			collectArtifacts(t, step.docket)
+		}
+	}()
+	step.Tester.Test(t)
+}
+
+// collectArtifacts writes a tarball of each router's configuration, routes,
+// neighbors, and logs along with the switch tables, xeth stats, and kernel
+// log.
+func collectArtifacts(t *testing.T, docket *docker.Docket) {
+	t.Helper()
+	var files []artifact
+	for _, r := range docket.Routers {
+		for _, x := range []struct {
+			name string
+			cmd  []string
+		}{
+			{"running-config", []string{"vtysh", "-c",
+				"show running-config"}},
+			{"addr", []string{"ip", "addr"}},
+			{"route", []string{"ip", "route", "show", "table",
+				"all"}},
+			{"route6", []string{"ip", "-6", "route", "show",
+				"table", "all"}},
+			{"neigh", []string{"ip", "neigh"}},
+			{"neigh6", []string{"ip", "-6", "neigh"}},
+		} {
+			out, err := docket.ExecCmd(t, r.Hostname, x.cmd...)
+			files = append(files, artifact{
+				filepath.Join(r.Hostname, x.name), out, err,
+			})
+		}
+		out, err := exec.Command("docker", "logs",
+			r.Hostname).CombinedOutput()
+		files = append(files, artifact{
+			filepath.Join(r.Hostname, "logs"), string(out), err,
+		})
+	}
+	for _, args := range [][]string{
+		{"fe1", "switch", "fib"},
+		{"fe1", "switch", "fib", "ip6"},
+		{"fe1", "switch", "adj"},
+		{"fe1", "xeth", "neigh"},
+	} {
+		out, err := exec.Command(*Goes, args...).CombinedOutput()
+		files = append(files, artifact{
+			filepath.Join("goes", strings.Join(args, "-")),
+			string(out), err,
+		})
+	}
+	stats, err := xethStats()
+	var names []string
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprint(&buf, name, ": ", stats[name], "\n")
+	}
+	files = append(files, artifact{"xeth-stats", buf.String(), err})
+	out, err := exec.Command("dmesg").CombinedOutput()
+	files = append(files, artifact{"dmesg", string(out), err})
+
+	fn := filepath.Join(*ArtifactDir, fmt.Sprint(
+		strings.Replace(t.Name(), "/", "-", -1), "-",
+		time.Now().Format("20060102T150405"), ".tar.gz"))
+	if err = writeArtifacts(fn, files); err != nil {
+		t.Log("artifacts:", err)
+	} else {
+		t.Log("artifacts:", fn)
+	}
+}
+
+// artifact is a bundled file; an error is appended to its content.
+type artifact struct {
+	name string
+	out  string
+	err  error
+}
+
+func writeArtifacts(fn string, files []artifact) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, f := range files {
+		s := f.out
+		if f.err != nil {
+			s += fmt.Sprintln("\nerror:", f.err)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    0644,
+			Size:    int64(len(s)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(s)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, buf.Bytes(), 0644)
+}
@@ -13,18 +13,12 @@ import (
 )
 
 func birdNetTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	t.Run("bgp", birdNetBgpTest)
 	t.Run("ospf", birdNetOspfTest)
 	test.SkipIfDryRun(t)
 }
 
 func birdVlanTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	t.Run("bgp", birdVlanBgpTest)
 	t.Run("ospf", birdVlanOspfTest)
 	test.SkipIfDryRun(t)
@@ -40,12 +34,14 @@ func birdVlanBgpTest(t *testing.T) {
 
 func birdBgpTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		birdBgpConnectivity{docket},
 		birdBgpDaemon{docket},
 		birdBgpNeighbors{docket},
 		birdBgpRoutes{docket},
+		fibConsistency{docket},
 		birdBgpInterConnectivity{docket},
+		offload{docket, "R1", "R3", "192.168.222.2", nil},
 		birdBgpFlap{docket},
 		birdBgpConnectivity{docket},
 		birdBgpAdminDown{docket})
@@ -61,11 +57,12 @@ func birdVlanOspfTest(t *testing.T) {
 
 func birdOspfTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		birdOspfConnectivity{docket},
 		birdOspfDaemon{docket},
 		birdOspfNeighbors{docket},
 		birdOspfRoutes{docket},
+		fibConsistency{docket},
 		birdOspfInterConnectivity{docket},
 		birdOspfFlap{docket},
 		birdOspfReconnectivity{docket},
@@ -116,8 +113,6 @@ type birdBgpNeighbors struct{ *docker.Docket }
 func (birdBgpNeighbors) String() string { return "neighbors" }
 
 func (bird birdBgpNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -131,22 +126,17 @@ func (bird birdBgpNeighbors) Test(t *testing.T) {
 		{"R4", "R1"},
 		{"R4", "R3"},
 	} {
-		found := false
-		timeout := 120
-
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := bird.ExecCmd(t, x.hostname,
 				"birdc", "show", "protocols", "all", x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, ".*Established.*") {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp peer established for %v", x.hostname)
+			return matchErr(out, ".*Established.*")
+		})
+		if err != nil {
+			t.Fatalf("No bgp peer established for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -156,8 +146,6 @@ type birdBgpRoutes struct{ *docker.Docket }
 func (birdBgpRoutes) String() string { return "routes" }
 
 func (bird birdBgpRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -171,21 +159,17 @@ func (bird birdBgpRoutes) Test(t *testing.T) {
 		{"R4", "192.168.120.0/24"},
 		{"R4", "192.168.222.0/24"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := bird.ExecCmd(t, x.hostname,
 				"ip", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No bgp route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -211,7 +195,7 @@ func (bird birdBgpInterConnectivity) Test(t *testing.T) {
 		{"R4", "192.168.222.10"},
 	} {
 		assert.Nil(bird.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -219,28 +203,10 @@ type birdBgpFlap struct{ *docker.Docket }
 
 func (birdBgpFlap) String() string { return "flap" }
 
-func (bird birdBgpFlap) Test(t *testing.T) {
-	assert := test.Assert{t}
+func (birdBgpFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range bird.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (bird birdBgpFlap) Test(t *testing.T) {
+	flapConvergence(t, bird.Docket, "bird-bgp", test.Ip4)
 }
 
 type birdBgpAdminDown struct{ *docker.Docket }
@@ -248,23 +214,7 @@ type birdBgpAdminDown struct{ *docker.Docket }
 func (birdBgpAdminDown) String() string { return "admin-down" }
 
 func (bird birdBgpAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range bird.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, bird.Docket, "bird-bgp", test.Ip4)
 	AssertNoAdjacencies(t)
 }
 
@@ -320,10 +270,6 @@ type birdOspfNeighbors struct{ *docker.Docket }
 func (birdOspfNeighbors) String() string { return "neighbors" }
 
 func (bird birdOspfNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	timeout := 120
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -337,20 +283,17 @@ func (bird birdOspfNeighbors) Test(t *testing.T) {
 		{"R4", "192.168.111.2"},
 		{"R4", "192.168.150.5"},
 	} {
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := bird.ExecCmd(t, x.hostname,
 				"birdc", "show", "ospf", "neighbor")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.peer) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf neighbor found for %v", x.hostname)
+			return matchErr(out, x.peer)
+		})
+		if err != nil {
+			t.Fatalf("No ospf neighbor found for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -360,8 +303,6 @@ type birdOspfRoutes struct{ *docker.Docket }
 func (birdOspfRoutes) String() string { return "routes" }
 
 func (bird birdOspfRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -375,21 +316,17 @@ func (bird birdOspfRoutes) Test(t *testing.T) {
 		{"R4", "192.168.120.0/24"},
 		{"R4", "192.168.222.0/24"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := bird.ExecCmd(t, x.hostname,
 				"ip", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No ospf route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -415,7 +352,7 @@ func (bird birdOspfInterConnectivity) Test(t *testing.T) {
 		{"R4", "192.168.222.10"},
 	} {
 		assert.Nil(bird.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -423,28 +360,10 @@ type birdOspfFlap struct{ *docker.Docket }
 
 func (birdOspfFlap) String() string { return "flap" }
 
-func (bird birdOspfFlap) Test(t *testing.T) {
-	assert := test.Assert{t}
+func (birdOspfFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range bird.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (bird birdOspfFlap) Test(t *testing.T) {
+	flapConvergence(t, bird.Docket, "bird-ospf", test.Ip4)
 }
 
 type birdOspfAdminDown struct{ *docker.Docket }
@@ -452,22 +371,6 @@ type birdOspfAdminDown struct{ *docker.Docket }
 func (birdOspfAdminDown) String() string { return "admin-down" }
 
 func (bird birdOspfAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range bird.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := bird.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, bird.Docket, "bird-ospf", test.Ip4)
 	AssertNoAdjacencies(t)
 }
@@ -0,0 +1,390 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package bmc is a client of the platina-mk1-bmc redis hash that the Mk1 BMC
+// serves at its IPv6 link-local address on the switch's management
+// interface.
+//
+// Client speaks just enough of the redis protocol for HGET and HGETALL so
+// that tests don't depend on redis-cli.
+package bmc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Hash = "platina-mk1-bmc"
+	Port = "6379"
+
+	DefaultTimeout = 3 * time.Second
+)
+
+// ProcNetRoute is the IPv4 routing table searched for the management
+// interface if that's not in the mac-ll output.
+var ProcNetRoute = "/proc/net/route"
+
+// Client sends commands to the redis server at Addr, a host:port.
+type Client struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// Error is a redis error reply.
+type Error string
+
+func (err Error) Error() string { return string(err) }
+
+// ErrNoField is returned by Hget for missing fields.
+var ErrNoField = errors.New("no such field")
+
+var linkLocalRe = regexp.MustCompile(
+	`IPv6 link-local:\s+([a-fA-F0-9:]+)(%(\S+))?`)
+var interfaceRe = regexp.MustCompile(`(?m)^\s*Interface:\s+(\S+)`)
+
+// ParseMacLl returns the BMC link-local address of "goes mac-ll" output and,
+// if listed, the interface that it's reached through.
+func ParseMacLl(out string) (ll net.IP, ifname string, err error) {
+	m := linkLocalRe.FindStringSubmatch(out)
+	if m == nil {
+		err = fmt.Errorf("mac-ll: no IPv6 link-local in %q", out)
+		return
+	}
+	if ll = net.ParseIP(m[1]); ll == nil || !ll.IsLinkLocalUnicast() {
+		err = fmt.Errorf("mac-ll: invalid link-local %q", m[1])
+		return
+	}
+	ifname = m[3]
+	if m := interfaceRe.FindStringSubmatch(out); len(ifname) == 0 &&
+		m != nil {
+		ifname = m[1]
+	}
+	return
+}
+
+// DefaultRouteIfname returns the interface of the default route in the
+// given /proc/net/route table.
+func DefaultRouteIfname(table string) (string, error) {
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+		// destination and mask
+		if fields[1] == "00000000" && fields[7] == "00000000" {
+			return fields[0], nil
+		}
+	}
+	return "", errors.New("no default route")
+}
+
+// Discover returns a client of the BMC named by the given "goes mac-ll"
+// output. If that doesn't identify the management interface, it's that of
+// the default route.
+func Discover(macll string) (*Client, error) {
+	ll, ifname, err := ParseMacLl(macll)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifname) == 0 {
+		b, err := ioutil.ReadFile(ProcNetRoute)
+		if err != nil {
+			return nil, err
+		}
+		if ifname, err = DefaultRouteIfname(string(b)); err != nil {
+			return nil, fmt.Errorf("management interface: %v", err)
+		}
+	}
+	return &Client{
+		Addr: net.JoinHostPort(ll.String()+"%"+ifname, Port),
+	}, nil
+}
+
+// Do sends a command and returns its reply; a string, int64, nil, or
+// []interface{} of these.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", c.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write(command(args...)); err != nil {
+		return nil, err
+	}
+	return reply(bufio.NewReader(conn))
+}
+
+// Hget returns the field of the BMC hash.
+func (c *Client) Hget(field string) (string, error) {
+	v, err := c.Do("HGET", Hash, field)
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		return "", fmt.Errorf("%s: %w", field, ErrNoField)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: unexpected reply %#v", field, v)
+	}
+	return s, nil
+}
+
+// Hgetall returns every field of the BMC hash.
+func (c *Client) Hgetall() (map[string]string, error) {
+	v, err := c.Do("HGETALL", Hash)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a)%2 != 0 {
+		return nil, fmt.Errorf("HGETALL: unexpected reply %#v", v)
+	}
+	m := make(map[string]string, len(a)/2)
+	for i := 0; i < len(a); i += 2 {
+		k, _ := a[i].(string)
+		v, _ := a[i+1].(string)
+		m[k] = v
+	}
+	return m, nil
+}
+
+// FanTray is the status and fan speeds of a tray, e.g. the fields
+//
+//	fan_tray.1.status: ok.front->back
+//	fan_tray.1.1.speed.units.rpm: 7000
+//	fan_tray.1.2.speed.units.rpm: 7100
+type FanTray struct {
+	Tray   int    `json:"tray"`
+	Status string `json:"status,omitempty"`
+	RPM    []int  `json:"rpm"`
+}
+
+// OK is true if the tray's status is "ok" or "ok.<airflow>".
+func (tray FanTray) OK() bool {
+	return tray.Status == "ok" || strings.HasPrefix(tray.Status, "ok.")
+}
+
+// Psu is the status and other fields of a power supply slot, e.g.
+//
+//	psu1.status: powered_on
+//	psu1.p_in.units.W: 112
+type Psu struct {
+	Slot   int               `json:"slot"`
+	Status string            `json:"status"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Present is false if the slot is empty.
+func (psu Psu) Present() bool {
+	return len(psu.Status) > 0 && psu.Status != "not_installed"
+}
+
+// OK is true if the supply is powered on.
+func (psu Psu) OK() bool {
+	return psu.Status == "powered_on"
+}
+
+// FanTrays returns the trays of the BMC hash ordered by number.
+func (c *Client) FanTrays() ([]FanTray, error) {
+	m, err := c.Hgetall()
+	if err != nil {
+		return nil, err
+	}
+	return FanTrays(m)
+}
+
+// Psus returns the power supply slots of the BMC hash ordered by number.
+func (c *Client) Psus() ([]Psu, error) {
+	m, err := c.Hgetall()
+	if err != nil {
+		return nil, err
+	}
+	return Psus(m)
+}
+
+// Temperatures returns the "<name>.units.C" fields of the BMC hash.
+func (c *Client) Temperatures() (map[string]float64, error) {
+	m, err := c.Hgetall()
+	if err != nil {
+		return nil, err
+	}
+	return Temperatures(m)
+}
+
+// FanTrays returns the trays of the given BMC fields.
+func FanTrays(m map[string]string) ([]FanTray, error) {
+	const prefix, suffix = "fan_tray.", ".speed.units.rpm"
+	trays := make(map[int]*FanTray)
+	tray := func(s string) (*FanTray, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("fan tray %q: %v", s, err)
+		}
+		if trays[n] == nil {
+			trays[n] = &FanTray{Tray: n}
+		}
+		return trays[n], nil
+	}
+	for k, v := range m {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		field := strings.Split(strings.TrimPrefix(k, prefix), ".")
+		switch {
+		case len(field) == 2 && field[1] == "status":
+			t, err := tray(field[0])
+			if err != nil {
+				return nil, err
+			}
+			t.Status = v
+		case strings.HasSuffix(k, suffix) && len(field) == 5:
+			t, err := tray(field[0])
+			if err != nil {
+				return nil, err
+			}
+			fan, err := strconv.Atoi(field[1])
+			if err != nil || fan < 1 {
+				return nil, fmt.Errorf("%s: invalid fan", k)
+			}
+			rpm, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			for len(t.RPM) < fan {
+				t.RPM = append(t.RPM, 0)
+			}
+			t.RPM[fan-1] = rpm
+		}
+	}
+	var list []FanTray
+	for _, t := range trays {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Tray < list[j].Tray
+	})
+	return list, nil
+}
+
+var psuRe = regexp.MustCompile(`^psu(\d+)\.(.+)$`)
+
+// Psus returns the power supply slots of the given BMC fields.
+func Psus(m map[string]string) ([]Psu, error) {
+	psus := make(map[int]*Psu)
+	for k, v := range m {
+		match := psuRe.FindStringSubmatch(k)
+		if match == nil {
+			continue
+		}
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		psu := psus[n]
+		if psu == nil {
+			psu = &Psu{Slot: n, Fields: make(map[string]string)}
+			psus[n] = psu
+		}
+		if match[2] == "status" {
+			psu.Status = v
+		} else {
+			psu.Fields[match[2]] = v
+		}
+	}
+	var list []Psu
+	for _, psu := range psus {
+		list = append(list, *psu)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Slot < list[j].Slot
+	})
+	return list, nil
+}
+
+// Temperatures returns the Celsius fields of the given BMC fields by name,
+// less the ".units.C" suffix.
+func Temperatures(m map[string]string) (map[string]float64, error) {
+	const suffix = ".units.C"
+	temps := make(map[string]float64)
+	for k, v := range m {
+		if !strings.HasSuffix(k, suffix) {
+			continue
+		}
+		c, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		temps[strings.TrimSuffix(k, suffix)] = c
+	}
+	return temps, nil
+}
+
+func command(args ...string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.Bytes()
+}
+
+// reply reads a redis protocol value.
+func reply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = reply(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("invalid reply %q", line)
+}
@@ -0,0 +1,234 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bmc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var fields = map[string]string{
+	"fan_tray.1.status":            "ok.front->back",
+	"fan_tray.1.1.speed.units.rpm": "7000",
+	"fan_tray.1.2.speed.units.rpm": "7100",
+	"fan_tray.2.status":            "not installed",
+	"fan_tray.speed":               "auto",
+	"psu1.status":                  "powered_on",
+	"psu1.p_in.units.W":            "112",
+	"psu1.temp1.units.C":           "31.5",
+	"psu2.status":                  "not_installed",
+	"temperature.bmc_cpu.units.C":  "42",
+	"machine":                      "platina-mk1-bmc",
+}
+
+// standIn starts a redis server of the platina-mk1-bmc hash and returns its
+// client and a function to stop it.
+func standIn(t *testing.T) (*Client, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return &Client{Addr: ln.Addr().String()}, func() { ln.Close() }
+}
+
+func serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := reply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range v.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+		var resp string
+		switch {
+		case len(args) == 3 && strings.EqualFold(args[0], "HGET") &&
+			args[1] == Hash:
+			if v, found := fields[args[2]]; found {
+				resp = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				resp = "$-1\r\n"
+			}
+		case len(args) == 2 && strings.EqualFold(args[0], "HGETALL") &&
+			args[1] == Hash:
+			var keys []string
+			for k := range fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			resp = fmt.Sprintf("*%d\r\n", 2*len(keys))
+			for _, k := range keys {
+				resp += fmt.Sprintf("$%d\r\n%s\r\n$%d\r\n%s\r\n",
+					len(k), k, len(fields[k]), fields[k])
+			}
+		default:
+			resp = fmt.Sprintf("-ERR unknown command '%s'\r\n",
+				args[0])
+		}
+		if _, err = conn.Write([]byte(resp)); err != nil {
+			return
+		}
+	}
+}
+
+func TestHget(t *testing.T) {
+	c, stop := standIn(t)
+	defer stop()
+	s, err := c.Hget("fan_tray.1.1.speed.units.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "7000" {
+		t.Errorf("got %q, want 7000", s)
+	}
+	if _, err = c.Hget("nonesuch"); !errors.Is(err, ErrNoField) {
+		t.Errorf("got %v, want %v", err, ErrNoField)
+	}
+	if _, err = c.Do("FLUSHALL"); err == nil {
+		t.Error("FLUSHALL succeeded")
+	} else if _, ok := err.(Error); !ok {
+		t.Errorf("%T isn't a redis Error", err)
+	}
+}
+
+func TestHgetall(t *testing.T) {
+	c, stop := standIn(t)
+	defer stop()
+	m, err := c.Hgetall()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, fields) {
+		t.Errorf("got %v\nwant %v", m, fields)
+	}
+}
+
+func TestFanTrays(t *testing.T) {
+	c, stop := standIn(t)
+	defer stop()
+	trays, err := c.FanTrays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FanTray{
+		{Tray: 1, Status: "ok.front->back", RPM: []int{7000, 7100}},
+		{Tray: 2, Status: "not installed"},
+	}
+	if !reflect.DeepEqual(trays, want) {
+		t.Errorf("got %+v\nwant %+v", trays, want)
+	}
+	if !trays[0].OK() || trays[1].OK() {
+		t.Error("wrong OK")
+	}
+}
+
+func TestPsus(t *testing.T) {
+	c, stop := standIn(t)
+	defer stop()
+	psus, err := c.Psus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Psu{
+		{Slot: 1, Status: "powered_on", Fields: map[string]string{
+			"p_in.units.W":  "112",
+			"temp1.units.C": "31.5",
+		}},
+		{Slot: 2, Status: "not_installed", Fields: map[string]string{}},
+	}
+	if !reflect.DeepEqual(psus, want) {
+		t.Errorf("got %+v\nwant %+v", psus, want)
+	}
+	if !psus[0].Present() || !psus[0].OK() || psus[1].Present() {
+		t.Error("wrong Present or OK")
+	}
+}
+
+func TestTemperatures(t *testing.T) {
+	c, stop := standIn(t)
+	defer stop()
+	temps, err := c.Temperatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"psu1.temp1":          31.5,
+		"temperature.bmc_cpu": 42,
+	}
+	if !reflect.DeepEqual(temps, want) {
+		t.Errorf("got %v, want %v", temps, want)
+	}
+}
+
+func TestParseMacLl(t *testing.T) {
+	for _, x := range []struct {
+		out, ll, ifname string
+	}{
+		{"IPv6 link-local: fe80::5218:4cff:fe00:1234\n",
+			"fe80::5218:4cff:fe00:1234", ""},
+		{"IPv6 link-local: fe80::1%eno1\n", "fe80::1", "eno1"},
+		{"Interface: eth1\nIPv6 link-local: fe80::1\n",
+			"fe80::1", "eth1"},
+	} {
+		ll, ifname, err := ParseMacLl(x.out)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if ll.String() != x.ll || ifname != x.ifname {
+			t.Errorf("%q: got %v %q, want %s %q", x.out, ll,
+				ifname, x.ll, x.ifname)
+		}
+	}
+	if _, _, err := ParseMacLl("IPv6 link-local: 2001:db8::1"); err == nil {
+		t.Error("accepted a global address")
+	}
+}
+
+func TestDefaultRouteIfname(t *testing.T) {
+	const table = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth1	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0100A8C0	0003	0	0	0	00000000	0	0	0
+`
+	ifname, err := DefaultRouteIfname(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifname != "eth0" {
+		t.Errorf("got %q, want eth0", ifname)
+	}
+	if _, err = DefaultRouteIfname(table[:strings.Index(table,
+		"eth0")]); err == nil {
+		t.Error("found a default route in", table)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	c, err := Discover("IPv6 link-local: fe80::1%eth0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[fe80::1%eth0]:6379"; c.Addr != want {
+		t.Errorf("got %q, want %q", c.Addr, want)
+	}
+}
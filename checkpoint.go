@@ -0,0 +1,145 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+var (
+	Checkpoint = flag.String("test.checkpoint", "checkpoint.json",
+		"record the outcome of each group and step in this file, \"\" to disable")
+	Resume = flag.Bool("test.resume", false,
+		"skip the groups of -test.checkpoint that passed on this goes buildid")
+)
+
+// checkpointFile has the outcome of each group and step completed by the
+// run, or runs, of a goes buildid.
+type checkpointFile struct {
+	Buildid string            `json:"buildid"`
+	Groups  map[string]string `json:"groups"`
+	Steps   map[string]string `json:"steps"`
+}
+
+var checkpoint struct {
+	sync.Mutex
+	checkpointFile
+	passed map[string]bool
+}
+
+// startCheckpoint creates the -test.checkpoint file for this run; with
+// -test.resume, it keeps the outcomes of an earlier run of the same goes
+// buildid and skips the groups that passed. Only -test.resume needs the
+// buildid; otherwise, the failure to get it is logged and the checkpoint
+// has none.
+func startCheckpoint() error {
+	if len(*Checkpoint) == 0 {
+		return nil
+	}
+	buildid, err := goesBuildid()
+	if err != nil {
+		if *Resume {
+			return fmt.Errorf("resume: buildid: %v", err)
+		}
+		fmt.Fprintln(os.Stderr, "checkpoint: buildid:", err)
+	}
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	checkpoint.Buildid = buildid
+	checkpoint.Groups = make(map[string]string)
+	checkpoint.Steps = make(map[string]string)
+	checkpoint.passed = make(map[string]bool)
+	if *Resume {
+		var prev checkpointFile
+		b, err := ioutil.ReadFile(*Checkpoint)
+		if err == nil {
+			err = json.Unmarshal(b, &prev)
+		}
+		switch {
+		case os.IsNotExist(err):
+			fmt.Println("resume: no", *Checkpoint)
+		case err != nil:
+			return fmt.Errorf("resume: %s: %v", *Checkpoint, err)
+		case len(buildid) == 0 || prev.Buildid != buildid:
+			fmt.Printf("resume: %s is of buildid %q, not %q\n",
+				*Checkpoint, prev.Buildid, buildid)
+		default:
+			for name, status := range prev.Groups {
+				checkpoint.Groups[name] = status
+				if status == "PASS" {
+					checkpoint.passed[name] = true
+				}
+			}
+			for name, status := range prev.Steps {
+				checkpoint.Steps[name] = status
+			}
+			fmt.Println("resume: skipping", len(checkpoint.passed),
+				"passed groups of", *Checkpoint)
+		}
+	}
+	return checkpoint.write()
+}
+
+// resumeSkipReason returns why the named group is skipped as having passed
+// before, or "".
+func resumeSkipReason(name string) string {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	if checkpoint.passed[name] {
+		return "passed on buildid " + checkpoint.Buildid
+	}
+	return ""
+}
+
+// recordCheckpoint updates the outcome of the named group.
+func recordCheckpoint(name, status string) {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	checkpoint.record(checkpoint.Groups, name, status)
+}
+
+// recordStep updates the outcome of the step once it and its cleanup are
+// done, including after a panic.
+func recordStep(t *testing.T) {
+	t.Cleanup(func() {
+		checkpoint.Lock()
+		defer checkpoint.Unlock()
+		checkpoint.record(checkpoint.Steps, t.Name(), testStatus(t))
+	})
+}
+
+// record updates the outcome in the map, then the file. A skip doesn't
+// replace an earlier pass.
+func (cf *checkpointFile) record(m map[string]string, name, status string) {
+	if m == nil {
+		return
+	}
+	if status == "SKIP" && m[name] == "PASS" {
+		return
+	}
+	m[name] = status
+	if err := cf.write(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// write replaces the checkpoint file so that it's never left partial.
+func (cf *checkpointFile) write() error {
+	b, err := json.MarshalIndent(cf, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := *Checkpoint + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *Checkpoint)
+}
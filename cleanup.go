@@ -0,0 +1,130 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/platinasystems/test/netport"
+)
+
+// undo is the registry of actions that release the containers, netns, and
+// links of the run should it be cut short by a signal before their own
+// teardown.
+var undo struct {
+	sync.Mutex
+	actions []*undoAction
+}
+
+type undoAction struct {
+	name string
+	f    func()
+}
+
+// atExit registers the named undo action and returns a function that
+// removes it once the resource is released by its own teardown.
+func atExit(name string, f func()) (release func()) {
+	a := &undoAction{name, f}
+	undo.Lock()
+	undo.actions = append(undo.actions, a)
+	undo.Unlock()
+	return func() {
+		undo.Lock()
+		defer undo.Unlock()
+		for i, x := range undo.actions {
+			if x == a {
+				undo.actions = append(undo.actions[:i],
+					undo.actions[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// runAtExit runs and removes the registered actions, newest first.
+func runAtExit() {
+	undo.Lock()
+	actions := undo.actions
+	undo.actions = nil
+	undo.Unlock()
+	for i := len(actions) - 1; i >= 0; i-- {
+		fmt.Fprintln(os.Stderr, "undo", actions[i].name)
+		actions[i].f()
+	}
+}
+
+// undoCleanup registers the named undo action for a signal or exit and as a
+// cleanup of the test, which the testing package runs should the test, or
+// any of its subtests, panic. The cleanup skips the action if the returned
+// function was called after the resource's own teardown.
+func undoCleanup(t *testing.T, name string, f func()) (torndown func()) {
+	release := atExit(name, f)
+	done := false
+	t.Cleanup(func() {
+		release()
+		if !done {
+			fmt.Fprintln(os.Stderr, "undo", name)
+			f()
+		}
+	})
+	return func() { done = true }
+}
+
+// undoOnSignal runs the registered actions then exits on SIGINT or SIGTERM.
+func undoOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		fmt.Fprintln(os.Stderr, sig)
+		runAtExit()
+		os.Exit(1)
+	}()
+}
+
+// undoRun runs a best effort undo command; the resource may already be gone.
+func undoRun(args ...string) {
+	exec.Command(args[0], args[1:]...).Run()
+}
+
+// undoNetDevs returns an action that moves the interfaces of the netdevs
+// back to the default netns, deleting their vlans and bridges, then deletes
+// the netns.
+func undoNetDevs(netdevs netport.NetDevs) func() {
+	return func() {
+		for i := len(netdevs) - 1; i >= 0; i-- {
+			nd := netdevs[i]
+			ns := nd.Netns
+			switch {
+			case nd.IsBridge:
+				undoRun("ip", "-n", ns, "link", "del", nd.Ifname)
+			case nd.Vlan != 0:
+				ifname := fmt.Sprint(netport.PortByNetPort[nd.NetPort],
+					".", nd.Vlan)
+				undoRun("ip", "-n", ns, "link", "set", ifname,
+					"netns", "1")
+				undoRun("ip", "link", "del", ifname)
+			default:
+				ifname := netport.PortByNetPort[nd.NetPort]
+				undoRun("ip", "-n", ns, "link", "set", ifname,
+					"netns", "1")
+				undoRun("ip", "link", "set", ifname, "up")
+			}
+		}
+		for _, nd := range netdevs {
+			_, err := os.Stat(filepath.Join("/var/run/netns", nd.Netns))
+			if err == nil {
+				undoRun("ip", "netns", "del", nd.Netns)
+			}
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// This is a simulated goes-platina-mk1 that answers the commands used by the
+// blackbox test from the Linux kernel's own routing and neighbor state.
+//
+//	go build ./cmd/goes-sim
+//	sudo ./goes-platina-mk1-blackbox.test -test.goes ./goes-sim -test.sim
+//
+// Supported commands:
+//
+//	fe1 switch fib [ip6]
+//	fe1 switch adj
+//	vnet show fe1 l3 pipe N
+//	fe1 xeth neigh
+//	hget platina-mk1 [KEY]
+//	mac-ll
+//	show buildid
+//	ip ...
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/fe1cli"
+	"github.com/platinasystems/test/netport"
+	"gopkg.in/yaml.v2"
+)
+
+const BuildId = "goes-sim"
+
+func main() {
+	if err := goes(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "goes-sim:", err)
+		os.Exit(1)
+	}
+}
+
+func goes(args []string) error {
+	cmd := strings.Join(args, " ")
+	switch {
+	case cmd == "fe1 switch fib":
+		return fib("-4")
+	case cmd == "fe1 switch fib ip6":
+		return fib("-6")
+	case cmd == "fe1 switch adj":
+		return adj()
+	case strings.HasPrefix(cmd, "vnet show fe1 l3 pipe "):
+		pipe, err := strconv.Atoi(args[len(args)-1])
+		if err != nil {
+			return err
+		}
+		return l3(pipe)
+	case cmd == "fe1 xeth neigh":
+		return neigh()
+	case len(args) >= 2 && args[0] == "hget" && args[1] == "platina-mk1":
+		return hget(args[2:])
+	case cmd == "mac-ll":
+		return macLl()
+	case cmd == "show buildid":
+		fmt.Println(BuildId)
+		return nil
+	case len(args) > 0 && args[0] == "ip":
+		ip, err := exec.LookPath("ip")
+		if err != nil {
+			return err
+		}
+		return syscall.Exec(ip, args, os.Environ())
+	}
+	return fmt.Errorf("%q unsupported", cmd)
+}
+
+// netns returns "default" and the named network namespaces.
+func netns() []string {
+	names := []string{"default"}
+	out, err := exec.Command("ip", "netns", "list").Output()
+	if err != nil {
+		return names
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names
+}
+
+func ip(ns string, args ...string) ([]string, error) {
+	if ns != "default" {
+		args = append([]string{"-n", ns}, args...)
+	}
+	out, err := exec.Command("ip", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
+
+func fieldAfter(fields []string, key string) string {
+	for i := range fields {
+		if fields[i] == key && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// fib prints the routes of each netns that the switch would program, those
+// through the netport.yaml ports or their vlans. These are taken from the
+// JSON of "ip route" with rules of the sim's own rather than by the
+// fe1cli.ParseIpRoute that the fib step applies to the routes of each
+// container so that the step still compares two independent tables.
+func fib(family string) error {
+	ports, err := netports()
+	if err != nil {
+		return err
+	}
+	var fib fe1cli.Fib
+	for _, ns := range netns() {
+		lines, err := ip(ns, "-j", family, "route", "show", "table",
+			"all")
+		if err != nil {
+			return err
+		}
+		var routes []route
+		err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &routes)
+		if err != nil {
+			return fmt.Errorf("%s: ip route: %v", ns, err)
+		}
+		for _, r := range routes {
+			if entry, ok := r.entry(ns, family, ports); ok {
+				fib = append(fib, entry)
+			}
+		}
+	}
+	fmt.Print(fib)
+	return nil
+}
+
+// netports returns the set of testdata/netport.yaml interfaces, the
+// switch ports that the sim stands in for.
+func netports() (map[string]bool, error) {
+	b, err := ioutil.ReadFile(netport.NetPortFile)
+	if err != nil {
+		return nil, err
+	}
+	portByNetPort := make(map[string]string)
+	if err = yaml.Unmarshal(b, portByNetPort); err != nil {
+		return nil, fmt.Errorf("%s: %v", netport.NetPortFile, err)
+	}
+	ports := make(map[string]bool)
+	for _, port := range portByNetPort {
+		ports[port] = true
+	}
+	return ports, nil
+}
+
+type nexthop struct {
+	Gateway string `json:"gateway"`
+	Dev     string `json:"dev"`
+}
+
+// route is an entry of "ip -j route show table all"; unicast routes have
+// no type.
+type route struct {
+	Type     string    `json:"type"`
+	Dst      string    `json:"dst"`
+	Gateway  string    `json:"gateway"`
+	Dev      string    `json:"dev"`
+	Nexthops []nexthop `json:"nexthops"`
+}
+
+// entry returns the fib entry of a route through a port or without an
+// interface, e.g. a blackhole. The switch punts link-local and multicast
+// prefixes rather than programming them.
+func (r route) entry(ns, family string, ports map[string]bool) (fe1cli.FibEntry,
+	bool) {
+	entry := fe1cli.FibEntry{Table: ns}
+	isPort := func(dev string) bool {
+		if i := strings.IndexByte(dev, '.'); i > 0 {
+			// vlan
+			dev = dev[:i]
+		}
+		return ports[dev]
+	}
+	switch r.Type {
+	case "", "unicast":
+	case "local":
+		entry.Kind = fe1cli.Local
+	case "blackhole":
+		entry.Kind = fe1cli.Drop
+	default:
+		return entry, false
+	}
+	if len(r.Dev) > 0 && !isPort(r.Dev) {
+		return entry, false
+	}
+	dst := r.Dst
+	switch {
+	case dst == "default" && family == "-6":
+		dst = "::/0"
+	case dst == "default":
+		dst = "0.0.0.0/0"
+	case strings.IndexByte(dst, '/') < 0 && strings.Contains(dst, ":"):
+		dst += "/128"
+	case strings.IndexByte(dst, '/') < 0:
+		dst += "/32"
+	}
+	addr, ipnet, err := net.ParseCIDR(dst)
+	if err != nil || addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return entry, false
+	}
+	entry.Prefix = ipnet.String()
+	if len(entry.Kind) > 0 {
+		return entry, true
+	}
+	switch {
+	case len(r.Gateway) > 0:
+		entry.Kind = fe1cli.Rewrite
+		entry.NextHops = []fe1cli.NextHop{{r.Gateway, r.Dev}}
+	case len(r.Nexthops) > 0:
+		entry.Kind = fe1cli.Rewrite
+		for _, nh := range r.Nexthops {
+			if isPort(nh.Dev) {
+				entry.NextHops = append(entry.NextHops,
+					fe1cli.NextHop{nh.Gateway, nh.Dev})
+			}
+		}
+		if len(entry.NextHops) == 0 {
+			return entry, false
+		}
+	case len(r.Dev) > 0:
+		entry.Kind = fe1cli.Glean
+		entry.Ifname = r.Dev
+	default:
+		return entry, false
+	}
+	return entry, true
+}
+
+type neighbor struct {
+	fe1cli.Neighbor
+	reachable bool
+}
+
+func neighbors() ([]neighbor, error) {
+	var neighbors []neighbor
+	for _, ns := range netns() {
+		lines, err := ip(ns, "neigh", "show")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			dev := fieldAfter(fields, "dev")
+			mac := fieldAfter(fields, "lladdr")
+			if len(fields) == 0 || !fe1cli.IsPort(dev) || mac == "" {
+				continue
+			}
+			state := fields[len(fields)-1]
+			neighbors = append(neighbors, neighbor{
+				Neighbor: fe1cli.Neighbor{
+					Netns:   ns,
+					Address: fields[0],
+					MAC:     mac,
+					Ifname:  dev,
+				},
+				reachable: state != "FAILED" &&
+					state != "INCOMPLETE",
+			})
+		}
+	}
+	return neighbors, nil
+}
+
+func adj() error {
+	neighbors, err := neighbors()
+	if err != nil {
+		return err
+	}
+	var adjs fe1cli.Adjacencies
+	for i, n := range neighbors {
+		adj := fe1cli.Adjacency{
+			Index:     i + 1,
+			Hard:      n.reachable,
+			L3Unicast: n.reachable,
+			MAC:       n.MAC,
+			Ifname:    n.Ifname,
+		}
+		if i := strings.IndexByte(n.Ifname, '.'); i > 0 {
+			adj.Vlan, _ = strconv.Atoi(n.Ifname[i+1:])
+		}
+		adjs = append(adjs, adj)
+	}
+	fmt.Print(adjs)
+	return nil
+}
+
+func neigh() error {
+	neighbors, err := neighbors()
+	if err != nil {
+		return err
+	}
+	var ns fe1cli.Neighbors
+	for _, n := range neighbors {
+		ns = append(ns, n.Neighbor)
+	}
+	fmt.Print(ns)
+	return nil
+}
+
+// l3 distributes the ports of all namespaces among the pipes by ifindex.
+// Interfaces without addresses have a nil class.
+func l3(pipe int) error {
+	var iifs fe1cli.L3Iifs
+	for _, ns := range netns() {
+		lines, err := ip(ns, "-o", "link", "show")
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			index, err := strconv.Atoi(strings.TrimSuffix(fields[0],
+				":"))
+			if err != nil || index%fe1cli.Pipes != pipe {
+				continue
+			}
+			ifname := strings.TrimSuffix(fields[1], ":")
+			if i := strings.IndexByte(ifname, '@'); i > 0 {
+				ifname = ifname[:i]
+			}
+			if !fe1cli.IsPort(ifname) {
+				continue
+			}
+			iif := fe1cli.L3Iif{
+				Pipe:    pipe,
+				Index:   index,
+				Ifname:  ifname,
+				ClassID: "nil",
+			}
+			addrs, _ := ip(ns, "-o", "addr", "show", "dev", ifname,
+				"scope", "global")
+			if len(addrs) > 0 && len(addrs[0]) > 0 {
+				iif.ClassID = strconv.Itoa(index)
+			}
+			iifs = append(iifs, iif)
+		}
+	}
+	fmt.Print(iifs)
+	return nil
+}
+
+// hget prints the simulated platina-mk1 keys containing any of the given
+// substrings, or all of them. These are those of testdata/platform.yaml, not
+// of a switch, so the hget step only checks their values with goes-sim.
+func hget(substrs []string) error {
+	m := map[string]string{
+		"machine":            "platina-mk1",
+		"packages.0.version": BuildId,
+		"sys.cpu.coretemp.C": coretemp(),
+		"sys.cpu.load1":      "0.00",
+	}
+	var ks []string
+	for k := range m {
+		if len(substrs) == 0 {
+			ks = append(ks, k)
+		}
+		for _, substr := range substrs {
+			if strings.Contains(k, substr) {
+				ks = append(ks, k)
+				break
+			}
+		}
+	}
+	if len(ks) == 0 {
+		return errors.New(strings.Join(substrs, " ") + ": not found")
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		fmt.Print(k, ": ", m[k], "\n")
+	}
+	return nil
+}
+
+// coretemp returns the temperature of the first thermal zone in Celsius.
+func coretemp() string {
+	b, err := ioutil.ReadFile("/sys/class/thermal/thermal_zone0/temp")
+	if err != nil {
+		return "40"
+	}
+	mc, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return "40"
+	}
+	return strconv.Itoa(mc / 1000)
+}
+
+// macLl prints the hardware and link-local address of the first interface
+// that has both.
+func macLl() error {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	for _, ifi := range ifs {
+		if len(ifi.HardwareAddr) == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || !ipnet.IP.IsLinkLocalUnicast() ||
+				ipnet.IP.To4() != nil {
+				continue
+			}
+			fmt.Print("MAC: ", ifi.HardwareAddr, "\n")
+			fmt.Print("IPv6 link-local: ", ipnet.IP, "\n")
+			return nil
+		}
+	}
+	return errors.New("no link-local address")
+}
@@ -0,0 +1,278 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/fe1cli"
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/docker"
+)
+
+var ConvergenceBudget = flag.Duration("test.convergence-budget", 0,
+	"fail flaps and admin-downs exceeding this hardware FIB convergence, 0 to only report")
+
+// Without a budget, flaps and admin-downs wait this long for convergence,
+// failing if it doesn't.
+const convergenceTimeout = 60 * time.Second
+
+// convergence is the time that it took the hardware FIB to withdraw the
+// routes through an interface after link-down and to reprogram these after
+// link-up. A negative duration means that it didn't converge.
+type convergence struct {
+	Router   string        `json:"router"`
+	Ifname   string        `json:"ifname"`
+	Prefixes int           `json:"prefixes"`
+	Down     time.Duration `json:"down_ns"`
+	Up       time.Duration `json:"up_ns"`
+}
+
+// flapConvergence bounces each interface of each router and measures how
+// long it takes the router's hardware routes through that interface to leave
+// the FIB and then return with their original next hops. Only the flapped
+// router's table is measured, not that of its peers.
+func flapConvergence(t *testing.T, docket *docker.Docket,
+	protocol, family string) {
+	t.Helper()
+	assert := test.Assert{t}
+	timeout := *ConvergenceBudget
+	if timeout == 0 {
+		timeout = convergenceTimeout
+	}
+	var timings []convergence
+	for _, r := range docket.Routers {
+		for _, i := range r.Intfs {
+			intf := i.Name
+			if i.Vlan != "" {
+				intf += "." + i.Vlan
+			}
+			fib, err := goesFib(family)
+			assert.Nil(err)
+			affected := fibVia(fib, r.Hostname, intf)
+			c := convergence{
+				Router:   r.Hostname,
+				Ifname:   intf,
+				Prefixes: len(affected),
+			}
+			withdrawn := func(fib fe1cli.Fib) error {
+				via := fibVia(fib, r.Hostname, intf)
+				for prefix := range affected {
+					if _, found := via[prefix]; found {
+						return fmt.Errorf("%s still via %s",
+							prefix, intf)
+					}
+				}
+				return nil
+			}
+			restored := func(fib fe1cli.Fib) error {
+				via := fibVia(fib, r.Hostname, intf)
+				for prefix, entry := range affected {
+					if !sameNextHops(via[prefix], entry) {
+						return fmt.Errorf("%s via %v != %v",
+							prefix, via[prefix].NextHops,
+							entry.NextHops)
+					}
+				}
+				return nil
+			}
+			start := time.Now()
+			_, err = docket.ExecCmd(t, r.Hostname,
+				"ip", "link", "set", "down", intf)
+			assert.Nil(err)
+			c.Down = converge(t, family, start, timeout, withdrawn)
+			start = time.Now()
+			_, err = docket.ExecCmd(t, r.Hostname,
+				"ip", "link", "set", "up", intf)
+			assert.Nil(err)
+			c.Up = converge(t, family, start, timeout, restored)
+			assert.Commentf("%s %s %d prefixes down %v up %v",
+				r.Hostname, intf, c.Prefixes, c.Down, c.Up)
+			assertConverged(t, r.Hostname+" "+intf, c.Down, c.Up)
+			timings = append(timings, c)
+		}
+	}
+	reportConvergence(t, protocol, family, timings)
+}
+
+// adminDownConvergence sets every interface of each router down and
+// measures how long it takes the hardware routes through these to leave the
+// FIB.
+func adminDownConvergence(t *testing.T, docket *docker.Docket,
+	protocol, family string) {
+	t.Helper()
+	assert := test.Assert{t}
+	timeout := *ConvergenceBudget
+	if timeout == 0 {
+		timeout = convergenceTimeout
+	}
+	type routerIntf struct{ router, intf string }
+	var intfs []routerIntf
+	for _, r := range docket.Routers {
+		for _, i := range r.Intfs {
+			intf := i.Name
+			if i.Vlan != "" {
+				intf += "." + i.Vlan
+			}
+			intfs = append(intfs, routerIntf{r.Hostname, intf})
+		}
+	}
+	fib, err := goesFib(family)
+	assert.Nil(err)
+	affected := make(map[routerIntf]map[string]fe1cli.FibEntry)
+	c := convergence{Router: "*", Ifname: "*"}
+	for _, x := range intfs {
+		affected[x] = fibVia(fib, x.router, x.intf)
+		c.Prefixes += len(affected[x])
+	}
+	withdrawn := func(fib fe1cli.Fib) error {
+		for x, prefixes := range affected {
+			via := fibVia(fib, x.router, x.intf)
+			for prefix := range prefixes {
+				if _, found := via[prefix]; found {
+					return fmt.Errorf("%s %s still via %s",
+						x.router, prefix, x.intf)
+				}
+			}
+		}
+		return nil
+	}
+	start := time.Now()
+	for _, x := range intfs {
+		_, err := docket.ExecCmd(t, x.router,
+			"ip", "link", "set", "down", x.intf)
+		assert.Nil(err)
+	}
+	c.Down = converge(t, family, start, timeout, withdrawn)
+	name := protocol + "-ip4"
+	if family == test.Ip6 {
+		name = protocol + "-ip6"
+	}
+	assert.Commentf("%s admin-down %d prefixes down %v", name,
+		c.Prefixes, c.Down)
+	assertConverged(t, "admin-down", c.Down)
+	results.metric(t, "admin-down-"+name, c)
+}
+
+// assertConverged fails the test if any of the durations didn't converge
+// or exceeded the -test.convergence-budget.
+func assertConverged(t *testing.T, what string, ds ...time.Duration) {
+	t.Helper()
+	for _, d := range ds {
+		switch budget := *ConvergenceBudget; {
+		case d < 0:
+			t.Errorf("%s didn't converge", what)
+			return
+		case budget > 0 && d > budget:
+			t.Errorf("%s exceeded %v convergence budget", what,
+				budget)
+			return
+		}
+	}
+}
+
+// converge returns the duration since start until the FIB satisfies the
+// given condition or, if it doesn't within the timeout, -1.
+func converge(t *testing.T, family string, start time.Time,
+	timeout time.Duration, f func(fe1cli.Fib) error) time.Duration {
+	t.Helper()
+	err := poll{
+		Timeout:  timeout,
+		Interval: 100 * time.Millisecond,
+	}.Eventually(func() error {
+		fib, err := goesFib(family)
+		if err != nil {
+			return err
+		}
+		return f(fib)
+	})
+	if err != nil {
+		t.Log(err)
+		return -1
+	}
+	return time.Since(start)
+}
+
+// fibVia returns the entries of the given table that are reached through
+// ifname keyed by prefix.
+func fibVia(fib fe1cli.Fib, table, ifname string) map[string]fe1cli.FibEntry {
+	via := make(map[string]fe1cli.FibEntry)
+	for _, entry := range fib {
+		if entry.Table != table {
+			continue
+		}
+		if entry.Ifname == ifname {
+			via[entry.Prefix] = entry
+			continue
+		}
+		for _, nh := range entry.NextHops {
+			if nh.Ifname == ifname {
+				via[entry.Prefix] = entry
+				break
+			}
+		}
+	}
+	return via
+}
+
+// sameNextHops is true if the entries are of the same kind with the same
+// set of next hops in any order.
+func sameNextHops(a, b fe1cli.FibEntry) bool {
+	return a.Kind == b.Kind && a.Ifname == b.Ifname &&
+		sameGateways(a.Gateways(), b.Gateways())
+}
+
+func reportConvergence(t *testing.T, protocol, family string,
+	timings []convergence) {
+	t.Helper()
+	name := protocol + "-ip4"
+	if family == test.Ip6 {
+		name = protocol + "-ip6"
+	}
+	var down, up []time.Duration
+	for _, c := range timings {
+		if c.Prefixes == 0 {
+			continue
+		}
+		down = append(down, c.Down)
+		up = append(up, c.Up)
+	}
+	test.Assert{t}.Commentf("%s convergence down %s up %s", name,
+		durationSummary(down), durationSummary(up))
+	results.metric(t, "convergence-"+name, timings)
+}
+
+// durationSummary returns the max and mean of the given durations or the
+// number that didn't converge.
+func durationSummary(ds []time.Duration) string {
+	var max, sum time.Duration
+	n, failed := 0, 0
+	for _, d := range ds {
+		if d < 0 {
+			failed++
+			continue
+		}
+		if d > max {
+			max = d
+		}
+		sum += d
+		n++
+	}
+	if len(ds) == 0 {
+		return "n/a"
+	}
+	if n == 0 {
+		return fmt.Sprint("none of ", len(ds))
+	}
+	s := fmt.Sprint("max ", max.Round(time.Millisecond), " mean ",
+		(sum / time.Duration(n)).Round(time.Millisecond))
+	if failed > 0 {
+		s += fmt.Sprint(", ", failed, " didn't converge")
+	}
+	return s
+}
@@ -15,22 +15,16 @@ import (
 )
 
 func dhcpNetTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	dhcpTest(t, "testdata/net/dhcp/conf.yaml.tmpl")
 }
 
 func dhcpVlanTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	dhcpTest(t, "testdata/net/dhcp/vlan/conf.yaml.tmpl")
 }
 
 func dhcpTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		dhcpConnectivity{docket},
 		dhcpServer{docket},
 		dhcpClient{docket},
@@ -73,26 +67,19 @@ func (dhcp dhcpServer) Test(t *testing.T) {
 	test.Pause.Prompt("Stop")
 	assert.Comment("Checking dhcp server on", "R2")
 	time.Sleep(1 * time.Second)
-	out, err := dhcp.ExecCmd(t, "R2", "ps", "ax")
-	assert.Nil(err)
-	//assert.Match(out, ".*dhcpd.*")
-	timeout := 5
-	found := false
-	for i := timeout; i > 0; i-- {
-		if !assert.MatchNonFatal(out, ".*dhcpd.*") {
-			if *test.VV {
-				fmt.Printf("check R2 ps ax, no match on dhcpd, %v retries left\n", i-1)
-				fmt.Printf("%v\n", out)
-			}
-			time.Sleep(2 * time.Second)
-			out, err = dhcp.ExecCmd(t, "R2", "ps", "ax")
-			continue
+	err := poll{
+		Timeout:  10 * time.Second,
+		Interval: 2 * time.Second,
+	}.Eventually(func() error {
+		out, err := dhcp.ExecCmd(t, "R2", "ps", "ax")
+		if err != nil {
+			return err
 		}
-		found = true
-	}
-	if !found {
+		return matchErr(out, ".*dhcpd.*")
+	})
+	if err != nil {
 		test.Pause.Prompt("dhcpd not found")
-		assert.Nil(fmt.Errorf("check dhcpd failed\n"))
+		assert.Nil(fmt.Errorf("check dhcpd failed: %v", err))
 	}
 }
 
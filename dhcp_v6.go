@@ -15,22 +15,16 @@ import (
 )
 
 func dhcpNetV6Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	dhcpV6Test(t, "testdata/net6/dhcp/conf.yaml.tmpl")
 }
 
 func dhcpVlanV6Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	dhcpV6Test(t, "testdata/net6/dhcp/vlan/conf.yaml.tmpl")
 }
 
 func dhcpV6Test(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		dhcpV6Connectivity{docket},
 		dhcpV6Server{docket},
 		dhcpV6Client{docket},
@@ -72,26 +66,19 @@ func (dhcp dhcpV6Server) Test(t *testing.T) {
 
 	assert.Comment("Checking dhcp server on", "R2")
 	time.Sleep(1 * time.Second)
-	out, err := dhcp.ExecCmd(t, "R2", "ps", "ax")
-	assert.Nil(err)
-	//assert.Match(out, ".*dhcpd.*")
-	timeout := 5
-	found := false
-	for i := timeout; i > 0; i-- {
-		if !assert.MatchNonFatal(out, ".*dhcpd.*") {
-			if *test.VV {
-				fmt.Printf("check R2 ps ax, no match on dhcpd, %v retries left\n", i-1)
-				fmt.Printf("%v\n", out)
-			}
-			time.Sleep(2 * time.Second)
-			out, err = dhcp.ExecCmd(t, "R2", "ps", "ax")
-			continue
+	err := poll{
+		Timeout:  10 * time.Second,
+		Interval: 2 * time.Second,
+	}.Eventually(func() error {
+		out, err := dhcp.ExecCmd(t, "R2", "ps", "ax")
+		if err != nil {
+			return err
 		}
-		found = true
-	}
-	if !found {
+		return matchErr(out, ".*dhcpd.*")
+	})
+	if err != nil {
 		test.Pause.Prompt("dhcpd not found")
-		assert.Nil(fmt.Errorf("check dhcpd failed\n"))
+		assert.Nil(fmt.Errorf("check dhcpd failed: %v", err))
 	}
 }
 
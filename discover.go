@@ -0,0 +1,273 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/test/ethtool"
+	"gopkg.in/yaml.v2"
+)
+
+var Discover = flag.String("test.discover", "",
+	"write the cabled pairs of ethtool.yaml ports to this netport.yaml")
+
+const (
+	// the IEEE 802 local experimental ethertype
+	probeEthertype = 0x88b5
+	probeMagic     = "goes-platina-mk1-blackbox probe "
+	probeWait      = time.Second
+	probeCarrier   = 10 * time.Second
+)
+
+// discover sends a probe frame out of each port in ethtool.yaml, pairs the
+// ports that receive each other's probe, and writes these pairs as
+// netNport0 and netNport1 to the named file. It reports ports that are
+// down or uncabled and returns the exit code, 1 if any of the ports
+// couldn't be paired.
+func discover(fn string) int {
+	ports, err := ethtoolPorts()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !*Sim && !*Veth {
+		ethtool.Init()
+	}
+	ecode := 0
+	var up []string
+	for _, port := range ports {
+		if err := linkSetUp(port); err != nil {
+			fmt.Println(port, err)
+			ecode = 1
+			continue
+		}
+		up = append(up, port)
+	}
+	carrier := up[:0]
+	for _, port := range up {
+		err := eventually(probeCarrier, func() error {
+			if !linkCarrier(port) {
+				return fmt.Errorf("no carrier")
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println(port, "down, no carrier")
+			ecode = 1
+			continue
+		}
+		carrier = append(carrier, port)
+	}
+	up = carrier
+	heard, err := probe(up)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	paired := make(map[string]bool)
+	var pairs [][2]string
+	for _, port := range up {
+		if paired[port] {
+			continue
+		}
+		from := heard[port]
+		switch {
+		case len(from) == 0:
+			fmt.Println(port, "uncabled, no probes received")
+			ecode = 1
+			continue
+		case len(from) > 1:
+			fmt.Println(port, "received probes from", from)
+			ecode = 1
+			continue
+		}
+		partner := from[0]
+		if back := heard[partner]; len(back) != 1 || back[0] != port {
+			fmt.Println(port, "received", partner, "but", partner,
+				"received", back)
+			ecode = 1
+			continue
+		}
+		paired[port] = true
+		paired[partner] = true
+		pairs = append(pairs, [2]string{port, partner})
+	}
+	var b bytes.Buffer
+	for n, pair := range pairs {
+		fmt.Fprintf(&b, "net%dport0: %s\n", n, pair[0])
+		fmt.Fprintf(&b, "net%dport1: %s\n", n, pair[1])
+	}
+	fmt.Print(b.String())
+	if err = ioutil.WriteFile(fn, b.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return ecode
+}
+
+// ethtoolPorts returns the interfaces of ethtool.yaml in port order.
+func ethtoolPorts() ([]string, error) {
+	b, err := ioutil.ReadFile(ethtool.SettingsFile)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]string)
+	if err = yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", ethtool.SettingsFile, err)
+	}
+	var ports []string
+	for port := range m {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return portLess(ports[i], ports[j])
+	})
+	return ports, nil
+}
+
+// portLess orders interface names by prefix then number, e.g. xeth3 before
+// xeth17.
+func portLess(a, b string) bool {
+	split := func(s string) (string, int) {
+		i := len(s)
+		for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+			i--
+		}
+		n, _ := strconv.Atoi(s[i:])
+		return s[:i], n
+	}
+	pa, na := split(a)
+	pb, nb := split(b)
+	if pa != pb {
+		return pa < pb
+	}
+	return na < nb
+}
+
+// linkSetUp brings up the port if it's down.
+func linkSetUp(port string) error {
+	up, err := linkAdminUp(port)
+	if err == nil && !up {
+		err = ipLinkSet(port, "up")
+	}
+	return err
+}
+
+// probe sends a frame out of each port and returns, by port, the ports whose
+// frame it received.
+func probe(ports []string) (map[string][]string, error) {
+	proto := htons(probeEthertype)
+	socks := make(map[string]int)
+	defer func() {
+		for _, fd := range socks {
+			syscall.Close(fd)
+		}
+	}()
+	for _, port := range ports {
+		ifi, err := net.InterfaceByName(port)
+		if err != nil {
+			return nil, err
+		}
+		fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW,
+			int(proto))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", port, err)
+		}
+		socks[port] = fd
+		err = syscall.Bind(fd, &syscall.SockaddrLinklayer{
+			Protocol: proto,
+			Ifindex:  ifi.Index,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", port, err)
+		}
+		tv := syscall.NsecToTimeval(int64(100 * time.Millisecond))
+		err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET,
+			syscall.SO_RCVTIMEO, &tv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", port, err)
+		}
+	}
+	var (
+		mu    sync.Mutex
+		heard = make(map[string][]string)
+		wg    sync.WaitGroup
+	)
+	deadline := time.Now().Add(probeWait)
+	for port, fd := range socks {
+		wg.Add(1)
+		go func(port string, fd int) {
+			defer wg.Done()
+			buf := make([]byte, 1518)
+			for time.Now().Before(deadline) {
+				n, _, err := syscall.Recvfrom(fd, buf, 0)
+				if err != nil || n < 14 {
+					continue
+				}
+				payload := string(buf[14:n])
+				if !strings.HasPrefix(payload, probeMagic) {
+					continue
+				}
+				from := strings.TrimRight(strings.TrimPrefix(
+					payload, probeMagic), "\x00")
+				if from == port {
+					continue
+				}
+				mu.Lock()
+				if !contains(heard[port], from) {
+					heard[port] = append(heard[port], from)
+				}
+				mu.Unlock()
+			}
+		}(port, fd)
+	}
+	for _, port := range ports {
+		ifi, _ := net.InterfaceByName(port)
+		frame := make([]byte, 14, 64)
+		copy(frame, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		copy(frame[6:], ifi.HardwareAddr)
+		frame[12] = probeEthertype >> 8
+		frame[13] = probeEthertype & 0xff
+		frame = append(frame, probeMagic+port...)
+		for len(frame) < 60 {
+			frame = append(frame, 0)
+		}
+		if _, err := syscall.Write(socks[port], frame); err != nil {
+			fmt.Println(port, "probe:", err)
+		}
+	}
+	wg.Wait()
+	for port := range heard {
+		sort.Slice(heard[port], func(i, j int) bool {
+			return portLess(heard[port][i], heard[port][j])
+		})
+	}
+	return heard, nil
+}
+
+func htons(i uint16) uint16 {
+	return i<<8 | i>>8
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -9,5 +9,143 @@ This provides a blackbox test of goes-platina-mk1.
 		git update-index --assume-unchanged $f
 	done
 	sudo ./goes-platina-mk1-blackbox.test -help
+
+Rather than edit testdata/netport.yaml by hand, discover the cabling of the
+ethtool.yaml ports with,
+
+	sudo ./goes-platina-mk1-blackbox.test \
+		-test.discover testdata/netport.yaml
+
+This applies the ethtool settings, brings up each port, then sends a probe
+frame out of each. Ports that receive each other's probe are written as the
+next netNport0 and netNport1 pair; those that are down, uncabled, or that
+hear more than one partner are reported and the exit status is 1.
+
+Without a Mk1, use the simulated goes that answers from the kernel's own
+routing and neighbor state.
+
+	go build ./cmd/goes-sim
+	sudo ./goes-platina-mk1-blackbox.test -test.goes ./goes-sim -test.sim
+
+The simulated fib is the kernel routes through the testdata/netport.yaml
+ports, read from "ip -j route" rather than with the parser that the fib step
+applies to each router's routes; so the step still compares the router with
+the sim's model of the switch, though it can't catch hardware programming
+errors.
+
+With -test.veth, each netport pair of testdata/netport.yaml is a veth pair,
+created before and removed after the run, instead of cabled xeth ports. This
+checks the topology templates, docker plumbing, and protocol steps without a
+switch; however, vlan and bridge configurations require xeth-vlan and
+xeth-bridge links so these are still limited to the hardware.
+
+	sudo ./goes-platina-mk1-blackbox.test -test.goes ./goes-sim -test.sim \
+		-test.veth -test.run Test/net4
+
+With -test.results-xml and/or -test.results-json, the run is verbose and each
+step's status, duration, and logs are written to the respective file along
+with the goes buildid, driver srcversion, and non-zero xeth stats. Since go
+doesn't mark which logs are errors, all logs of a failed step are its
+failures.
+
+The first failed step of each docket writes a tarball to -test.artifact-dir
+(default, the current directory) before the containers are torn down. This
+has each router's running-config, addresses, routes, neighbors, and container
+log along with the switch fib, adj, and xeth neigh tables, the xeth stats, and
+dmesg.
+
+Steps that wait for daemons, neighbors, or routes poll with a fixed interval
+and timeout. On slow builds, stretch these with -test.timeout-scale; e.g. 2
+doubles every timeout.
+
+Flap steps time how long the hardware FIB takes to withdraw the routes
+through each bounced interface and to reprogram them, with the same next
+hops in any order; admin-down steps time the withdrawal of the routes
+through all interfaces. These timings are reported per protocol and address
+family, and are included in the exported results. A flap or admin-down that
+doesn't converge within a minute fails, as does one that takes longer than
+-test.convergence-budget, if given.
+
+Some disruptive steps run with a background stream of sequence numbered UDP
+datagrams between routers, sent at -test.stream-interval. Each such step
+reports loss, longest outage, and reordering. Adding and deleting routes must
+not lose any datagrams; for flaps, loss is only reported.
+
+Flood and stress steps use a built-in generator, not hping3. It sends ICMP
+echo, UDP, or TCP-SYN probes from a router or netport netns, with a given TTL,
+DSCP, and packet size, for both IPv4 and IPv6. Each run reports packets sent,
+received, and lost, along with latency percentiles. The rate is
+-test.flood-rate packets per second; 0, the default, sends as fast as
+possible.
+
+The offload steps of the static, frr, bird, gobgp, and slice suites send a
+UDP burst across the routers and compare what the kernel received on the
+transit xeth interfaces with the switch port counter matching
+-test.hw-rx-counter. Each fails if more than -test.punt-threshold of the
+burst was punted to the CPU.
+
+The xeth stats are sampled around every step and their deltas are attached
+to that step's result; with -test.xeth-stat, these are also logged. A step
+fails if a delta exceeds its limit in -test.xeth-thresholds, by default
+testdata/xeth_thresholds.yaml, which has the maximum increase of each
+counter pattern by suite.
+
+Throughout the run, the CPU coretemp from goes hget and the fan, PSU, and
+temperature fields of the BMC redis are sampled every
+-test.telemetry-interval, then exported with the results. The BMC is reached
+at the link-local address of goes mac-ll through the management interface
+that it names or, otherwise, that of the default route. These are also
+sampled at the beginning and end of flood and stress steps; any hotter than
+-test.max-cpu-temp fails the step.
+
+Suites and steps are tagged: ipv4, ipv6, vlan, bridge, platform, stress,
+long, and needs-docker-image, for the steps of a docket with an image that
+docker must pull. Select these with a comma separated -test.tags where !tag
+excludes those so tagged; e.g.
+
+	sudo ./goes-platina-mk1-blackbox.test -test.tags 'ipv6,!stress'
+
+-test.short excludes long. With !needs-docker-image, a docket missing an
+image is skipped rather than pulled. To see what would run and why the rest
+would be skipped, without running anything,
+
+	./goes-platina-mk1-blackbox.test -test.list-tags -test.tags ipv4
+
+By default, a failure skips every later group. With -test.policy continue,
+all groups run regardless; with continue-within-group, the rest of the top
+level group of the failure, e.g. vlan4, runs but the groups after it are
+skipped. The run ends with a table of each group that passed, failed, or was
+skipped and why.
+
+As each group and step completes, its outcome is written to
+-test.checkpoint, by default checkpoint.json, along with the goes buildid,
+if available. After a crash or an interrupt, rerun with -test.resume to skip
+the groups that already passed with the same buildid; this needs the
+buildid. A group that was cut short is run again from its start since its
+steps depend on the setup of those before.
+
+Each docket, netport configuration, and netns of the nsif and multipath
+groups registers an undo action as it starts and releases it after its own
+teardown. The test's cleanup runs the action should one of its steps panic,
+and on SIGINT, SIGTERM, or the end of the run, whatever remains is undone,
+newest first: interfaces are moved back to the default netns, vlan and dummy
+links are deleted, and containers and netns are removed, so that an
+interrupted run doesn't break the next.
+
+After a crash that left no chance to undo, sweep with,
+
+	sudo ./goes-platina-mk1-blackbox.test -test.sweep
+
+This moves the ports in the netns of the netport configurations and of the
+testdata template routers back to the default netns, deletes their vlans,
+bridges, and dummies, removes the template containers and these netns, then
+brings up the ports of netport.yaml. Each change is reported.
+
+Every run writes -test.manifest, by default manifest.json, with the goes
+buildid and sha256, the kernel release and version, the srcversion of the
+-test.platform-driver and -test.xeth-module modules, the digest of each
+docker image as its docket starts, the contents of netport.yaml,
+ethtool.yaml, and ethtool_priv_flags.yaml, and the flags given to the run.
+The manifest is also included in the exported results.
 */
 package main
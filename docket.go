@@ -0,0 +1,148 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/docker"
+	"github.com/platinasystems/test/netport"
+	"gopkg.in/yaml.v2"
+)
+
+// docketTest runs the given tests with the docket's containers, checking
+// the xeth stat deltas of each and collecting artifacts of the first
+// failure, then, after their teardown, verifies that the switch tables are
+// as they were before. If the docket is missing an image, its steps are
+// tagged needs-docker-image for docker to pull it. The docket is skipped if
+// none of its steps are selected by their tags.
+func docketTest(t *testing.T, docket *docker.Docket, tests ...test.Tester) {
+	t.Helper()
+	var needs []string
+	if !*test.DryRun || *ListTags {
+		if missingImage(docket.Tmpl) != nil {
+			needs = append(needs, "needs-docker-image")
+		}
+	}
+	steps := make([]test.Tester, len(tests))
+	selected := false
+	reason := "no selected steps"
+	for i, v := range tests {
+		step := tagStep{artifactStep{xethStep{v}, docket},
+			append(stepTags(v), needs...)}
+		if r := step.skipReason(stepName(t, v)); len(r) == 0 {
+			selected = true
+		} else if i == 0 {
+			reason = r
+		}
+		steps[i] = step
+	}
+	if !selected {
+		skipGroup(t, reason)
+	}
+	if listSteps(t, steps...) {
+		return
+	}
+	if *test.DryRun {
+		docket.Test(t, tests...)
+		return
+	}
+	// after docker pulls any missing image
+	defer addManifestImages(docket.Tmpl)
+	before := hwSnapshot(t)
+	config, err := tmplConfig(docket.Tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torndown := undoCleanup(t, "docket "+docket.Tmpl, undoDocket(config))
+	docket.Test(t, steps...)
+	torndown()
+	assertNoLeaks(t, before)
+}
+
+// tmplConfig returns the docket configuration of the template as translated
+// by docker.Docket.Test.
+func tmplConfig(tmpl string) (*docker.Config, error) {
+	text, err := ioutil.ReadFile(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(tmpl, ".tmpl")
+	tm, err := template.New(name).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = tm.Execute(buf, netport.PortByNetPort); err != nil {
+		return nil, err
+	}
+	config := new(docker.Config)
+	if err = yaml.Unmarshal(buf.Bytes(), config); err != nil {
+		return nil, fmt.Errorf("%s: %v", tmpl, err)
+	}
+	return config, nil
+}
+
+// undoDocket returns an action that, like docker.TearDownContainers, moves
+// the interfaces of each router back to the default netns, deleting its
+// vlans, dummies, and bridges, then removes its container and netns.
+func undoDocket(config *docker.Config) func() {
+	return func() {
+		for i := len(config.Routers) - 1; i >= 0; i-- {
+			r := config.Routers[i]
+			for _, intf := range r.Intfs {
+				switch {
+				case intf.IsBridge:
+				case intf.Vlan != "":
+					ifname := intf.Name + "." + intf.Vlan
+					undoRun("ip", "-n", r.Hostname, "link", "set",
+						ifname, "netns", "1")
+					undoRun("ip", "link", "del", ifname)
+				case strings.Contains(intf.Name, "dummy"):
+					undoRun("ip", "-n", r.Hostname, "link", "set",
+						intf.Name, "netns", "1")
+					undoRun("ip", "link", "del", intf.Name)
+				default:
+					undoRun("ip", "-n", r.Hostname, "link", "set",
+						intf.Name, "netns", "1")
+					undoRun("ip", "link", "set", intf.Name, "up")
+				}
+			}
+			for _, intf := range r.Intfs {
+				if intf.IsBridge {
+					undoRun("ip", "-n", r.Hostname, "link", "del",
+						intf.Name)
+				}
+			}
+			undoRun("docker", "rm", "-f", r.Hostname)
+			undoRun("rm", "-f", filepath.Join("/var/run/netns",
+				r.Hostname))
+		}
+	}
+}
+
+// missingImage returns an error naming the first image of the template that
+// docker doesn't have.
+func missingImage(tmpl string) error {
+	images, err := tmplImages(tmpl)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		err = exec.Command("docker", "image", "inspect", image).Run()
+		if err != nil {
+			return fmt.Errorf("no %s", image)
+		}
+	}
+	return nil
+}
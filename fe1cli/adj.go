@@ -0,0 +1,74 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Adjacency is a line of "goes fe1 switch adj" output.
+//
+//	index  hard|soft  key: value...
+//
+// Where the keys are l3_unicast, mac, port, vlan, and rewrite; port is
+// required.
+type Adjacency struct {
+	Index     int
+	Hard      bool
+	L3Unicast bool
+	MAC       string `json:",omitempty"`
+	Ifname    string
+	Vlan      int    `json:",omitempty"`
+	Rewrite   string `json:",omitempty"`
+}
+
+type Adjacencies []Adjacency
+
+// ParseAdjacencies returns the entries of "goes fe1 switch adj" output.
+func ParseAdjacencies(out string) (Adjacencies, error) {
+	var adjs Adjacencies
+	err := lines("adj", out, "index", func(fields []string) error {
+		if len(fields) < 2 {
+			return errors.New("missing hard or soft")
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return err
+		}
+		adj := Adjacency{Index: index}
+		switch fields[1] {
+		case "hard":
+			adj.Hard = true
+		case "soft":
+		default:
+			return errors.New("neither hard nor soft")
+		}
+		m, err := attrs(fields[2:])
+		if err != nil {
+			return err
+		}
+		if s, found := m["l3_unicast"]; found {
+			if adj.L3Unicast, err = strconv.ParseBool(s); err != nil {
+				return err
+			}
+		}
+		if s, found := m["mac"]; found {
+			if adj.MAC, err = lladdr(s); err != nil {
+				return err
+			}
+		}
+		if adj.Ifname = m["port"]; len(adj.Ifname) == 0 {
+			return errors.New("missing port")
+		}
+		if adj.Vlan, err = atoi(m, "vlan"); err != nil {
+			return err
+		}
+		adj.Rewrite = m["rewrite"]
+		adjs = append(adjs, adj)
+		return nil
+	})
+	return adjs, err
+}
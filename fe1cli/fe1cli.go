@@ -0,0 +1,123 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package fe1cli parses the output of goes fe1 commands into structures that
+// tests may assert on by field rather than by pattern.
+//
+// Each parser is strict about the columns that it depends on so that a change
+// in the goes output format results in a ParseError identifying the
+// offending line instead of a silent mismatch.
+//
+// The testdata/*.out fixtures are to be the output of a switch running the
+// blackbox dockets, with their headers and multi-line entries as is. Those
+// checked in are NOT; they were written by hand to the expected format, so
+// the suites only log the parse errors of their fib and adj assertions. To
+// record them, and the parsed *.golden, on a Mk1 with the dockets up,
+//
+//	go test ./fe1cli -capture /usr/bin/goes -update
+package fe1cli
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseError identifies the command output line that couldn't be parsed.
+type ParseError struct {
+	Cmd  string
+	Line int
+	Text string
+	Err  error
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s: line %d: %v: %q", err.Cmd, err.Line, err.Err,
+		err.Text)
+}
+
+// lines calls f with the number and fields of each non-blank line that isn't
+// a column header beginning with the given name.
+func lines(cmd, out, header string, f func(fields []string) error) error {
+	for i, text := range strings.Split(out, "\n") {
+		text = strings.TrimRight(text, "\r")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.EqualFold(fields[0], header) {
+			continue
+		}
+		if err := f(fields); err != nil {
+			return &ParseError{cmd, i + 1, text, err}
+		}
+	}
+	return nil
+}
+
+// prefix returns the canonical CIDR notation of the given prefix or address,
+// expanding host addresses to /32 or /128.
+func prefix(s string) (string, error) {
+	if strings.IndexByte(s, '/') < 0 {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("invalid prefix %q", s)
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", err
+	}
+	return ipnet.String(), nil
+}
+
+func address(s string) (string, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("invalid address %q", s)
+	}
+	return ip.String(), nil
+}
+
+func lladdr(s string) (string, error) {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return "", err
+	}
+	return mac.String(), nil
+}
+
+// attrs parses "key: value" pairs.
+func attrs(fields []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for i := 0; i < len(fields); i++ {
+		k := fields[i]
+		if !strings.HasSuffix(k, ":") {
+			return nil, fmt.Errorf("unexpected %q", k)
+		}
+		if i+1 == len(fields) {
+			return nil, fmt.Errorf("%q without value", k)
+		}
+		i++
+		m[strings.TrimSuffix(k, ":")] = fields[i]
+	}
+	return m, nil
+}
+
+func atoi(attrs map[string]string, k string) (int, error) {
+	s, found := attrs[k]
+	if !found {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", k, err)
+	}
+	return i, nil
+}
@@ -0,0 +1,260 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var (
+	update  = flag.Bool("update", false, "rewrite testdata/*.golden")
+	capture = flag.String("capture", "",
+		"rewrite testdata/*.out with the output of this goes")
+)
+
+func TestGolden(t *testing.T) {
+	for _, x := range []struct {
+		name  string
+		cmd   []string
+		parse func(string) (interface{}, error)
+	}{
+		{"fib", []string{"fe1", "switch", "fib"},
+			func(s string) (interface{}, error) {
+				return ParseFib(s)
+			}},
+		{"fib6", []string{"fe1", "switch", "fib", "ip6"},
+			func(s string) (interface{}, error) {
+				return ParseFib(s)
+			}},
+		{"adj", []string{"fe1", "switch", "adj"},
+			func(s string) (interface{}, error) {
+				return ParseAdjacencies(s)
+			}},
+		{"neigh", []string{"fe1", "xeth", "neigh"},
+			func(s string) (interface{}, error) {
+				return ParseNeighbors(s)
+			}},
+		{"l3", []string{"vnet", "show", "fe1", "l3", "pipe", "0"},
+			func(s string) (interface{}, error) {
+				return ParseL3Iifs(0, s)
+			}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			fn := filepath.Join("testdata", x.name)
+			if len(*capture) > 0 {
+				out, err := exec.Command(*capture,
+					x.cmd...).Output()
+				if err != nil {
+					t.Fatal(*capture, x.cmd, err)
+				}
+				if err = ioutil.WriteFile(fn+".out", out,
+					0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b, err := ioutil.ReadFile(fn + ".out")
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := x.parse(string(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(v, "", "\t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+			if *update {
+				if err = ioutil.WriteFile(fn+".golden", got,
+					0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(fn + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s.out parsed to\n%s\nwant\n%s",
+					fn, got, want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, x := range []struct {
+		name  string
+		parse func(string) (fmt.Stringer, error)
+	}{
+		{"fib", func(s string) (fmt.Stringer, error) {
+			return ParseFib(s)
+		}},
+		{"fib6", func(s string) (fmt.Stringer, error) {
+			return ParseFib(s)
+		}},
+		{"adj", func(s string) (fmt.Stringer, error) {
+			return ParseAdjacencies(s)
+		}},
+		{"neigh", func(s string) (fmt.Stringer, error) {
+			return ParseNeighbors(s)
+		}},
+		{"l3", func(s string) (fmt.Stringer, error) {
+			return ParseL3Iifs(0, s)
+		}},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			b, err := ioutil.ReadFile(filepath.Join("testdata",
+				x.name+".out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := x.parse(string(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := v.String()
+			w, err := x.parse(s)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, s)
+			}
+			if !reflect.DeepEqual(v, w) {
+				t.Errorf("%s reparsed as %+v", s, w)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, x := range []struct {
+		name  string
+		out   string
+		parse func(string) error
+		line  int
+	}{
+		{
+			"fib-prefix",
+			"table prefix adjacency\nR1 10.1.0.0/24 glean xeth1\nR1 10.1.0 local\n",
+			func(s string) error {
+				_, err := ParseFib(s)
+				return err
+			},
+			3,
+		},
+		{
+			"fib-next-hop",
+			"R1 10.3.0.0/24 10.2.0.3 xeth3, 10.2.1.3\n",
+			func(s string) error {
+				_, err := ParseFib(s)
+				return err
+			},
+			1,
+		},
+		{
+			"adj-flags",
+			"index adjacency\n1 firm l3_unicast: true port: xeth1\n",
+			func(s string) error {
+				_, err := ParseAdjacencies(s)
+				return err
+			},
+			2,
+		},
+		{
+			"adj-port",
+			"1 hard l3_unicast: true mac: 02:46:8a:00:00:01\n",
+			func(s string) error {
+				_, err := ParseAdjacencies(s)
+				return err
+			},
+			1,
+		},
+		{
+			"l3-class-id",
+			"index iif\n1 xeth1 class_id: 1\n2 xeth3 vrf: 0\n",
+			func(s string) error {
+				_, err := ParseL3Iifs(0, s)
+				return err
+			},
+			3,
+		},
+		{
+			"neigh-columns",
+			"netns address lladdr dev\nR1 10.1.0.2 xeth1\n",
+			func(s string) error {
+				_, err := ParseNeighbors(s)
+				return err
+			},
+			2,
+		},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			err := x.parse(x.out)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected ParseError, got %v", err)
+			}
+			if perr.Line != x.line {
+				t.Errorf("line %d, want %d: %v", perr.Line,
+					x.line, err)
+			}
+		})
+	}
+}
+
+func TestParseIpRoute(t *testing.T) {
+	out := `default via 10.1.0.2 dev xeth1 proto static metric 20
+10.1.0.0/24 dev xeth1 proto kernel scope link src 10.1.0.1
+10.3.0.0/24 proto static metric 20
+	nexthop via 10.1.0.2 dev xeth1 weight 1
+	nexthop via 192.168.0.2 dev dummy0 weight 1
+	nexthop via 10.2.0.3 dev xeth3 weight 1
+192.168.0.0/24 dev dummy0 proto kernel scope link src 192.168.0.1
+192.168.1.0/24 via 192.168.0.2 dev dummy0
+blackhole 10.9.0.0/25
+broadcast 10.1.0.255 dev xeth1 table local proto kernel scope link src 10.1.0.1
+local 10.1.0.1 dev xeth1 table local proto kernel scope host src 10.1.0.1
+local 192.168.0.1 dev dummy0 table local proto kernel scope host src 192.168.0.1
+local 127.0.0.1 dev lo table local proto kernel scope host src 127.0.0.1
+`
+	want := Fib{
+		{Table: "R1", Prefix: "0.0.0.0/0", Kind: Rewrite,
+			NextHops: []NextHop{{"10.1.0.2", "xeth1"}}},
+		{Table: "R1", Prefix: "10.1.0.0/24", Kind: Glean,
+			Ifname: "xeth1"},
+		{Table: "R1", Prefix: "10.3.0.0/24", Kind: Rewrite,
+			NextHops: []NextHop{
+				{"10.1.0.2", "xeth1"},
+				{"10.2.0.3", "xeth3"},
+			}},
+		{Table: "R1", Prefix: "10.9.0.0/25", Kind: Drop},
+		{Table: "R1", Prefix: "10.1.0.1/32", Kind: Local},
+	}
+	if got := ParseIpRoute("R1", "-4", out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed\n%s\nwant\n%s", got, want)
+	}
+	out = `2001:db8:1::/64 dev xeth1 proto kernel metric 256 pref medium
+2001:db8:9::/64 dev dummy0 proto kernel metric 256 pref medium
+fe80::/64 dev xeth1 proto kernel metric 256 pref medium
+default via 2001:db8:1::2 dev xeth1 metric 1024 pref medium
+`
+	want = Fib{
+		{Table: "R1", Prefix: "2001:db8:1::/64", Kind: Glean,
+			Ifname: "xeth1"},
+		{Table: "R1", Prefix: "::/0", Kind: Rewrite,
+			NextHops: []NextHop{{"2001:db8:1::2", "xeth1"}}},
+	}
+	if got := ParseIpRoute("R1", "-6", out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"errors"
+	"strings"
+)
+
+// Fib entry kinds; entries with next hops are Rewrite.
+const (
+	Glean   = "glean"
+	Local   = "local"
+	Drop    = "drop"
+	Punt    = "punt"
+	Rewrite = "rewrite"
+)
+
+// NextHop is a gateway address and its egress interface.
+type NextHop struct {
+	Address string
+	Ifname  string
+}
+
+// FibEntry is a line of "goes fe1 switch fib [ip6]" output.
+//
+//	table  prefix  adjacency
+//
+// Where adjacency is either a kind with an optional interface,
+//
+//	glean xeth1
+//	local
+//	drop
+//
+// or a comma separated list of next hop address and interface pairs.
+//
+//	10.1.0.2 xeth1, 10.2.0.2 xeth3
+type FibEntry struct {
+	Table    string
+	Prefix   string
+	Kind     string
+	Ifname   string    `json:",omitempty"`
+	NextHops []NextHop `json:",omitempty"`
+}
+
+type Fib []FibEntry
+
+// ParseFib returns the entries of "goes fe1 switch fib [ip6]" output.
+func ParseFib(out string) (Fib, error) {
+	var fib Fib
+	err := lines("fib", out, "table", func(fields []string) error {
+		if len(fields) < 3 {
+			return errors.New("missing adjacency")
+		}
+		pfx, err := prefix(fields[1])
+		if err != nil {
+			return err
+		}
+		entry := FibEntry{
+			Table:  fields[0],
+			Prefix: pfx,
+		}
+		adj := fields[2:]
+		switch adj[0] {
+		case Glean, Local, Drop, Punt:
+			entry.Kind = adj[0]
+			switch len(adj) {
+			case 1:
+			case 2:
+				entry.Ifname = adj[1]
+			default:
+				return errors.New("trailing " + adj[2])
+			}
+		default:
+			entry.Kind = Rewrite
+			pairs := strings.Split(strings.Join(adj, " "), ",")
+			for _, pair := range pairs {
+				nh := strings.Fields(pair)
+				if len(nh) != 2 {
+					return errors.New("malformed next hop")
+				}
+				addr, err := address(nh[0])
+				if err != nil {
+					return err
+				}
+				entry.NextHops = append(entry.NextHops,
+					NextHop{addr, nh[1]})
+			}
+		}
+		fib = append(fib, entry)
+		return nil
+	})
+	return fib, err
+}
+
+// Tables returns the entries keyed by table name then prefix.
+func (fib Fib) Tables() map[string]map[string]FibEntry {
+	tables := make(map[string]map[string]FibEntry)
+	for _, entry := range fib {
+		table, found := tables[entry.Table]
+		if !found {
+			table = make(map[string]FibEntry)
+			tables[entry.Table] = table
+		}
+		table[entry.Prefix] = entry
+	}
+	return tables
+}
+
+// Gateways returns the next hop addresses of the entry.
+func (entry FibEntry) Gateways() []string {
+	var gws []string
+	for _, nh := range entry.NextHops {
+		gws = append(gws, nh.Address)
+	}
+	return gws
+}
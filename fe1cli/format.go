@@ -0,0 +1,93 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// The String methods format entries as goes does, such that the respective
+// Parse functions return the same entries.
+
+func columns(header string, rows func(w *tabwriter.Writer)) string {
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	rows(w)
+	w.Flush()
+	return buf.String()
+}
+
+func (fib Fib) String() string {
+	return columns("table\tprefix\tadjacency", func(w *tabwriter.Writer) {
+		for _, entry := range fib {
+			var adj string
+			switch entry.Kind {
+			case Rewrite:
+				var nhs []string
+				for _, nh := range entry.NextHops {
+					nhs = append(nhs,
+						nh.Address+" "+nh.Ifname)
+				}
+				adj = strings.Join(nhs, ", ")
+			default:
+				adj = strings.TrimSpace(entry.Kind + " " +
+					entry.Ifname)
+			}
+			fmt.Fprint(w, entry.Table, "\t", entry.Prefix, "\t",
+				adj, "\n")
+		}
+	})
+}
+
+func (adjs Adjacencies) String() string {
+	return columns("index\tadjacency", func(w *tabwriter.Writer) {
+		for _, adj := range adjs {
+			flag := "soft"
+			if adj.Hard {
+				flag = "hard"
+			}
+			fmt.Fprint(w, adj.Index, "\t", flag, " l3_unicast: ",
+				adj.L3Unicast)
+			if len(adj.MAC) > 0 {
+				fmt.Fprint(w, " mac: ", adj.MAC)
+			}
+			fmt.Fprint(w, " port: ", adj.Ifname)
+			if adj.Vlan != 0 {
+				fmt.Fprint(w, " vlan: ", adj.Vlan)
+			}
+			if len(adj.Rewrite) > 0 {
+				fmt.Fprint(w, " rewrite: ", adj.Rewrite)
+			}
+			fmt.Fprintln(w)
+		}
+	})
+}
+
+func (neighbors Neighbors) String() string {
+	return columns("netns\taddress\tlladdr\tdev",
+		func(w *tabwriter.Writer) {
+			for _, n := range neighbors {
+				fmt.Fprint(w, n.Netns, "\t", n.Address, "\t",
+					n.MAC, "\t", n.Ifname, "\n")
+			}
+		})
+}
+
+func (iifs L3Iifs) String() string {
+	return columns("index\tiif", func(w *tabwriter.Writer) {
+		for _, iif := range iifs {
+			fmt.Fprint(w, iif.Index, "\t", iif.Ifname,
+				"\tclass_id: ", iif.ClassID)
+			if iif.Vrf != 0 {
+				fmt.Fprint(w, " vrf: ", iif.Vrf)
+			}
+			fmt.Fprintln(w)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Pipes of the fe1 switch, each with its own L3 ingress interface table.
+const Pipes = 4
+
+// L3Iif is a line of "goes vnet show fe1 l3 pipe N" output.
+//
+//	index  ifname  key: value...
+//
+// Where the keys are class_id, which may be nil, and vrf.
+type L3Iif struct {
+	Pipe    int
+	Index   int
+	Ifname  string
+	ClassID string
+	Vrf     int `json:",omitempty"`
+}
+
+type L3Iifs []L3Iif
+
+// ParseL3Iifs returns the entries of "goes vnet show fe1 l3 pipe N" output.
+func ParseL3Iifs(pipe int, out string) (L3Iifs, error) {
+	var iifs L3Iifs
+	err := lines("l3", out, "index", func(fields []string) error {
+		if len(fields) < 2 {
+			return errors.New("missing ifname")
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return err
+		}
+		m, err := attrs(fields[2:])
+		if err != nil {
+			return err
+		}
+		iif := L3Iif{
+			Pipe:   pipe,
+			Index:  index,
+			Ifname: fields[1],
+		}
+		var found bool
+		if iif.ClassID, found = m["class_id"]; !found {
+			return errors.New("missing class_id")
+		}
+		if iif.Vrf, err = atoi(m, "vrf"); err != nil {
+			return err
+		}
+		iifs = append(iifs, iif)
+		return nil
+	})
+	return iifs, err
+}
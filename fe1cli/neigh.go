@@ -0,0 +1,58 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import "errors"
+
+// Neighbor is a line of "goes fe1 xeth neigh" output.
+//
+//	netns  address  lladdr  dev
+type Neighbor struct {
+	Netns   string
+	Address string
+	MAC     string
+	Ifname  string
+}
+
+type Neighbors []Neighbor
+
+// ParseNeighbors returns the entries of "goes fe1 xeth neigh" output.
+func ParseNeighbors(out string) (Neighbors, error) {
+	var neighbors Neighbors
+	err := lines("neigh", out, "netns", func(fields []string) error {
+		if len(fields) != 4 {
+			return errors.New("expected netns, address, lladdr, dev")
+		}
+		addr, err := address(fields[1])
+		if err != nil {
+			return err
+		}
+		mac, err := lladdr(fields[2])
+		if err != nil {
+			return err
+		}
+		neighbors = append(neighbors, Neighbor{
+			Netns:   fields[0],
+			Address: addr,
+			MAC:     mac,
+			Ifname:  fields[3],
+		})
+		return nil
+	})
+	return neighbors, err
+}
+
+// Find returns the neighbor entry with the given address.
+func (neighbors Neighbors) Find(addr string) (Neighbor, bool) {
+	if s, err := address(addr); err == nil {
+		addr = s
+	}
+	for _, neighbor := range neighbors {
+		if neighbor.Address == addr {
+			return neighbor, true
+		}
+	}
+	return Neighbor{}, false
+}
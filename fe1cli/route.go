@@ -0,0 +1,128 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fe1cli
+
+import (
+	"net"
+	"strings"
+)
+
+// PortPrefixes are those of the interfaces that the switch programs routes
+// through, the xeth front panel ports and the eth- and veth interfaces that
+// stand in for them with goes-sim.
+var PortPrefixes = []string{"xeth", "eth-", "veth"}
+
+// IsPort is true of an interface with one of the PortPrefixes.
+func IsPort(ifname string) bool {
+	for _, prefix := range PortPrefixes {
+		if strings.HasPrefix(ifname, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIpRoute returns the entries of the named table that the switch
+// programs for the kernel routes of "ip [-4|-6] route show table all"
+// output. Broadcast, multicast, link-local, and loopback routes, along with
+// those through an interface that isn't a port, e.g. dummy0, have no
+// hardware counterpart so these are skipped, as are the next hops of a
+// multipath route through such interfaces.
+func ParseIpRoute(table, family, out string) Fib {
+	var fib Fib
+	var multipath *FibEntry
+	flush := func() {
+		if multipath != nil && len(multipath.NextHops) > 0 {
+			fib = append(fib, *multipath)
+		}
+		multipath = nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(strings.TrimRight(line, "\r"))
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "nexthop" {
+			dev := fieldAfter(fields, "dev")
+			addr, err := address(fieldAfter(fields, "via"))
+			if multipath != nil && IsPort(dev) && err == nil {
+				multipath.NextHops = append(multipath.NextHops,
+					NextHop{addr, dev})
+			}
+			continue
+		}
+		flush()
+		entry := FibEntry{Table: table}
+		switch fields[0] {
+		case "broadcast", "multicast", "anycast", "unreachable",
+			"prohibit", "throw":
+			continue
+		case "local":
+			entry.Kind = Local
+			fields = fields[1:]
+		case "blackhole":
+			entry.Kind = Drop
+			fields = fields[1:]
+		case "unicast":
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "default" {
+			if family == "-6" {
+				fields[0] = "::/0"
+			} else {
+				fields[0] = "0.0.0.0/0"
+			}
+		}
+		pfx, err := prefix(fields[0])
+		if err != nil {
+			continue
+		}
+		ip, _, _ := net.ParseCIDR(pfx)
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+			ip.IsMulticast() {
+			continue
+		}
+		dev := fieldAfter(fields, "dev")
+		if len(dev) > 0 && !IsPort(dev) {
+			continue
+		}
+		entry.Prefix = pfx
+		if len(entry.Kind) == 0 {
+			gw := fieldAfter(fields, "via")
+			switch {
+			case len(gw) > 0:
+				addr, err := address(gw)
+				if err != nil {
+					continue
+				}
+				entry.Kind = Rewrite
+				entry.NextHops = []NextHop{{addr, dev}}
+			case len(dev) > 0:
+				entry.Kind = Glean
+				entry.Ifname = dev
+			default:
+				// multipath, next hops follow
+				entry.Kind = Rewrite
+				multipath = &entry
+				continue
+			}
+		}
+		fib = append(fib, entry)
+	}
+	flush()
+	return fib
+}
+
+func fieldAfter(fields []string, key string) string {
+	for i := range fields {
+		if fields[i] == key && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
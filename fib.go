@@ -0,0 +1,248 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/fe1cli"
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/docker"
+)
+
+// fibRoute is a prefix and its next hop gateways as seen by either a router's
+// kernel or the switch hardware.
+type fibRoute struct {
+	Prefix   string
+	Local    bool
+	Gateways []string
+}
+
+// fibTable maps prefixes to routes of a single table (netns).
+type fibTable map[string]fibRoute
+
+// fibDiff lists the inconsistencies of a hardware table with its kernel RIB.
+type fibDiff struct {
+	Table   string
+	Missing []string
+	Extra   []string
+	NextHop []string
+}
+
+func (diff fibDiff) Empty() bool {
+	return len(diff.Missing) == 0 && len(diff.Extra) == 0 &&
+		len(diff.NextHop) == 0
+}
+
+func (diff fibDiff) String() string {
+	var lines []string
+	for _, x := range []struct {
+		what     string
+		prefixes []string
+	}{
+		{"missing", diff.Missing},
+		{"extra", diff.Extra},
+		{"wrong next-hop", diff.NextHop},
+	} {
+		for _, p := range x.prefixes {
+			lines = append(lines, fmt.Sprint("table ", diff.Table,
+				": ", x.what, " ", p))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fibConsistency verifies that goes fe1 switch fib holds what each router's
+// kernel has installed.
+type fibConsistency struct{ *docker.Docket }
+
+func (fibConsistency) String() string { return "fib" }
+
+func (fib fibConsistency) Test(t *testing.T) {
+	assert := test.Assert{t}
+	assert.Comment("compare container RIBs with goes fib")
+	diffs, err := fibInconsistencies(t, fib.Docket)
+	assert.Nil(err)
+	for _, diff := range diffs {
+		t.Error(diff)
+	}
+}
+
+// fibInconsistencies returns the differences between the kernel routes of
+// each Docket router and their respective hardware tables. Since the switch
+// programs routes asynchronously, this retries for a while before reporting
+// inconsistencies.
+func fibInconsistencies(t *testing.T, docket *docker.Docket) ([]fibDiff,
+	error) {
+	t.Helper()
+	var diffs []fibDiff
+	err := eventually(10*time.Second, func() error {
+		var err error
+		diffs, err = fibDiffs(t, docket)
+		if err != nil {
+			return err
+		}
+		if len(diffs) > 0 {
+			if *test.VV {
+				t.Log(len(diffs), "inconsistent tables")
+			}
+			return fmt.Errorf("%d inconsistent tables", len(diffs))
+		}
+		return nil
+	})
+	if len(diffs) > 0 {
+		err = nil
+	}
+	return diffs, err
+}
+
+func fibDiffs(t *testing.T, docket *docker.Docket) ([]fibDiff, error) {
+	t.Helper()
+	var diffs []fibDiff
+	for _, family := range []string{test.Ip4, test.Ip6} {
+		fib, err := goesFib(family)
+		if err != nil {
+			return nil, err
+		}
+		hw := fibTables(fib)
+		for _, r := range docket.Routers {
+			out, err := docket.ExecCmd(t, r.Hostname,
+				"ip", family, "route", "show", "table", "all")
+			if err != nil {
+				t.Log(r.Hostname, "ip", family, "route", err)
+				continue
+			}
+			kernel := fibTables(fe1cli.ParseIpRoute(r.Hostname,
+				family, out))
+			diff := compareFib(r.Hostname, kernel[r.Hostname],
+				hw[r.Hostname])
+			if !diff.Empty() {
+				diffs = append(diffs, diff)
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// compareFib reports kernel prefixes missing from the hardware table, hardware
+// prefixes unknown to the kernel, and routes with differing gateways.
+// Hardware host routes that the kernel doesn't have are neighbor adjacencies
+// rather than leaked routes so these aren't reported as extra.
+func compareFib(table string, kernel, hw fibTable) fibDiff {
+	diff := fibDiff{Table: table}
+	for prefix, kr := range kernel {
+		hr, found := hw[prefix]
+		if !found {
+			diff.Missing = append(diff.Missing, prefix)
+			continue
+		}
+		if len(kr.Gateways) == 0 {
+			continue
+		}
+		if !sameGateways(kr.Gateways, hr.Gateways) {
+			diff.NextHop = append(diff.NextHop,
+				fmt.Sprint(prefix, " kernel ", kr.Gateways,
+					" fib ", hr.Gateways))
+		}
+	}
+	for prefix := range hw {
+		if _, found := kernel[prefix]; found {
+			continue
+		}
+		if isHostPrefix(prefix) {
+			continue
+		}
+		diff.Extra = append(diff.Extra, prefix)
+	}
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Extra)
+	sort.Strings(diff.NextHop)
+	return diff
+}
+
+func sameGateways(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool)
+	for _, gw := range a {
+		set[gw] = true
+	}
+	for _, gw := range b {
+		if !set[gw] {
+			return false
+		}
+	}
+	return true
+}
+
+func isHostPrefix(prefix string) bool {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+	ones, bits := ipnet.Mask.Size()
+	return ones == bits
+}
+
+// goesFib returns the parsed hardware routes of the given family.
+func goesFib(family string) (fe1cli.Fib, error) {
+	out, err := goesFibOutput(family)
+	if err != nil {
+		return nil, err
+	}
+	return fe1cli.ParseFib(out)
+}
+
+func goesFibOutput(family string) (string, error) {
+	args := []string{"fe1", "switch", "fib"}
+	if family == test.Ip6 {
+		args = append(args, "ip6")
+	}
+	out, err := exec.Command(*Goes, args...).Output()
+	return string(out), err
+}
+
+// fibTables converts parsed kernel or hardware routes to tables keyed by name.
+func fibTables(fib fe1cli.Fib) map[string]fibTable {
+	tables := make(map[string]fibTable)
+	for name, entries := range fib.Tables() {
+		table := make(fibTable)
+		for prefix, entry := range entries {
+			table[prefix] = fibRoute{
+				Prefix:   prefix,
+				Local:    entry.Kind == fe1cli.Local,
+				Gateways: entry.Gateways(),
+			}
+		}
+		tables[name] = table
+	}
+	return tables
+}
+
+// assertGoesFib asserts that goes shows the hardware routes of the given
+// family and logs them if -test.vv. Since the fe1cli fixtures weren't
+// recorded from a switch, a parse error is only logged.
+func assertGoesFib(t *testing.T, family string) {
+	t.Helper()
+	out, err := goesFibOutput(family)
+	test.Assert{t}.Nil(err)
+	fib, err := fe1cli.ParseFib(out)
+	if err != nil {
+		t.Log(err)
+		return
+	}
+	if *test.VV {
+		for _, entry := range fib {
+			t.Logf("%+v", entry)
+		}
+	}
+}
@@ -20,7 +20,9 @@ var (
 	PlatformDriver = flag.String("test.platform-driver", "platina-mk1",
 		"Linux Kernel Platform Driver")
 	XethStat = flag.Bool("test.xeth-stat", false,
-		"show /sys/kernel/platina-mk1/xeth stats")
+		"show /sys/kernel/platina-mk1/xeth stats and their step deltas")
+	Sim = flag.Bool("test.sim", false,
+		"simulated goes (cmd/goes-sim), skip socket and ethtool setup")
 )
 
 func assertFlags() {
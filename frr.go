@@ -36,12 +36,14 @@ func frrVlanBgpTest(t *testing.T) {
 
 func frrBgpTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrBgpConnectivity{docket},
 		frrBgpDaemons{docket},
 		frrBgpNeighbors{docket},
 		frrBgpRoutes{docket},
+		fibConsistency{docket},
 		frrBgpInterConnectivity{docket},
+		offload{docket, "R1", "R3", "192.168.222.2", nil},
 		frrBgpFlap{docket},
 		frrBgpConnectivity{docket},
 		frrBgpAdminDown{docket})
@@ -57,12 +59,13 @@ func frrVlanOspfTest(t *testing.T) {
 
 func frrOspfTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrOspfCarrier{docket},
 		frrOspfConnectivity{docket},
 		frrOspfDaemons{docket},
 		frrOspfNeighbors{docket},
 		frrOspfRoutes{docket},
+		fibConsistency{docket},
 		frrOspfInterConnectivity{docket},
 		frrOspfFlap{docket},
 		frrOspfConnectivity{docket},
@@ -79,12 +82,13 @@ func frrVlanIsisTest(t *testing.T) {
 
 func frrIsisTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrIsisConnectivity{docket},
 		frrIsisDaemons{docket},
 		frrIsisAddIntfConf{docket},
 		frrIsisNeighbors{docket},
 		frrIsisRoutes{docket},
+		fibConsistency{docket},
 		frrIsisInterConnectivity{docket},
 		frrIsisFlap{docket},
 		frrIsisConnectivity{docket},
@@ -136,8 +140,6 @@ type frrBgpNeighbors struct{ *docker.Docket }
 func (frrBgpNeighbors) String() string { return "neighbors" }
 
 func (frr frrBgpNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -151,22 +153,17 @@ func (frr frrBgpNeighbors) Test(t *testing.T) {
 		{"R4", "192.168.111.2"},
 		{"R4", "192.168.150.5"},
 	} {
-		found := false
-		timeout := 120
-
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ip bgp neighbor "+x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, ".*state = Established.*") {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp peer established for %v", x.hostname)
+			return matchErr(out, ".*state = Established.*")
+		})
+		if err != nil {
+			t.Fatalf("No bgp peer established for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -176,8 +173,6 @@ type frrBgpRoutes struct{ *docker.Docket }
 func (frrBgpRoutes) String() string { return "routes" }
 
 func (frr frrBgpRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -191,21 +186,17 @@ func (frr frrBgpRoutes) Test(t *testing.T) {
 		{"R4", "192.168.120.0/24"},
 		{"R4", "192.168.222.0/24"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"ip", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No bgp route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -232,7 +223,7 @@ func (frr frrBgpInterConnectivity) Test(t *testing.T) {
 	} {
 		err := frr.PingCmd(t, x.hostname, x.target)
 		assert.Nil(err)
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -240,32 +231,10 @@ type frrBgpFlap struct{ *docker.Docket }
 
 func (frrBgpFlap) String() string { return "flap" }
 
-func (frr frrBgpFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrBgpFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (frr frrBgpFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-bgp", test.Ip4)
 }
 
 type frrBgpAdminDown struct{ *docker.Docket }
@@ -273,23 +242,7 @@ type frrBgpAdminDown struct{ *docker.Docket }
 func (frrBgpAdminDown) String() string { return "admin-down" }
 
 func (frr frrBgpAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-bgp", test.Ip4)
 	AssertNoAdjacencies(t)
 }
 
@@ -360,10 +313,6 @@ type frrOspfNeighbors struct{ *docker.Docket }
 func (frrOspfNeighbors) String() string { return "neighbors" }
 
 func (frr frrOspfNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	timeout := 120
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -377,20 +326,17 @@ func (frr frrOspfNeighbors) Test(t *testing.T) {
 		{"R4", "192.168.111.2"},
 		{"R4", "192.168.150.5"},
 	} {
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ip ospf neighbor")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.peer) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf neighbor found for %v", x.hostname)
+			return matchErr(out, x.peer)
+		})
+		if err != nil {
+			t.Fatalf("No ospf neighbor found for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -400,8 +346,6 @@ type frrOspfRoutes struct{ *docker.Docket }
 func (frrOspfRoutes) String() string { return "routes" }
 
 func (frr frrOspfRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -415,21 +359,17 @@ func (frr frrOspfRoutes) Test(t *testing.T) {
 		{"R4", "192.168.120.0/24"},
 		{"R4", "192.168.222.0/24"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"ip", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No ospf route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -455,7 +395,7 @@ func (frr frrOspfInterConnectivity) Test(t *testing.T) {
 		{"R4", "192.168.222.10"},
 	} {
 		assert.Nil(frr.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -463,32 +403,10 @@ type frrOspfFlap struct{ *docker.Docket }
 
 func (frrOspfFlap) String() string { return "flap" }
 
-func (frr frrOspfFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrOspfFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (frr frrOspfFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-ospf", test.Ip4)
 }
 
 type frrOspfAdminDown struct{ *docker.Docket }
@@ -496,23 +414,7 @@ type frrOspfAdminDown struct{ *docker.Docket }
 func (frrOspfAdminDown) String() string { return "admin-down" }
 
 func (frr frrOspfAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-ospf", test.Ip4)
 	AssertNoAdjacencies(t)
 }
 
@@ -586,8 +488,6 @@ type frrIsisNeighbors struct{ *docker.Docket }
 func (frrIsisNeighbors) String() string { return "neighbors" }
 
 func (frr frrIsisNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -602,22 +502,17 @@ func (frr frrIsisNeighbors) Test(t *testing.T) {
 		{"R4", "R3", "192.168.111.2"},
 		{"R4", "R1", "192.168.150.5"},
 	} {
-		timeout := 60
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show isis neighbor "+x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.address) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No isis neighbor for %v: %v",
-				x.hostname, x.peer)
+			return matchErr(out, x.address)
+		})
+		if err != nil {
+			t.Fatalf("No isis neighbor for %v: %v: %v",
+				x.hostname, x.peer, err)
 		}
 	}
 }
@@ -627,8 +522,6 @@ type frrIsisRoutes struct{ *docker.Docket }
 func (frrIsisRoutes) String() string { return "routes" }
 
 func (frr frrIsisRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -642,21 +535,17 @@ func (frr frrIsisRoutes) Test(t *testing.T) {
 		{"R4", "192.168.120.0/24"},
 		{"R4", "192.168.222.0/24"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ip route isis")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No isis route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No isis route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -682,7 +571,7 @@ func (frr frrIsisInterConnectivity) Test(t *testing.T) {
 		{"R4", "192.168.222.10"},
 	} {
 		assert.Nil(frr.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -690,32 +579,10 @@ type frrIsisFlap struct{ *docker.Docket }
 
 func (frrIsisFlap) String() string { return "flap" }
 
-func (frr frrIsisFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrIsisFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (frr frrIsisFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-isis", test.Ip4)
 }
 
 type frrIsisAdminDown struct{ *docker.Docket }
@@ -723,22 +590,6 @@ type frrIsisAdminDown struct{ *docker.Docket }
 func (frrIsisAdminDown) String() string { return "admin-down" }
 
 func (frr frrIsisAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-isis", test.Ip4)
 	AssertNoAdjacencies(t)
 }
@@ -32,12 +32,13 @@ func frrVlanV6BgpTest(t *testing.T) {
 
 func frrV6BgpTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrV6BgpConnectivity{docket},
 		frrV6BgpDaemons{docket},
 		frrV6BgpBfd{docket},
 		frrV6BgpNeighbors{docket},
 		frrV6BgpRoutes{docket},
+		fibConsistency{docket},
 		frrV6BgpInterConnectivity{docket},
 		frrV6BgpFlap{docket},
 		frrV6BgpConnectivity{docket},
@@ -54,13 +55,14 @@ func frrVlanV6OspfTest(t *testing.T) {
 
 func frrV6OspfTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrV6OspfCarrier{docket},
 		frrV6OspfConnectivity{docket},
 		frrV6OspfDaemons{docket},
 		frrV6OspfConfig{docket},
 		frrV6OspfNeighbors{docket},
 		frrV6OspfRoutes{docket},
+		fibConsistency{docket},
 		frrV6OspfInterConnectivity{docket},
 		frrV6OspfFlap{docket},
 		frrV6OspfConnectivity{docket},
@@ -77,12 +79,13 @@ func frrVlanV6IsisTest(t *testing.T) {
 
 func frrV6IsisTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		frrV6IsisConnectivity{docket},
 		frrV6IsisDaemons{docket},
 		frrV6IsisAddIntfConf{docket},
 		frrV6IsisNeighbors{docket},
 		frrV6IsisRoutes{docket},
+		fibConsistency{docket},
 		frrV6IsisInterConnectivity{docket},
 		frrV6IsisFlap{docket},
 		frrV6IsisConnectivity{docket},
@@ -162,8 +165,6 @@ type frrV6BgpNeighbors struct{ *docker.Docket }
 func (frrV6BgpNeighbors) String() string { return "neighbors" }
 
 func (frr frrV6BgpNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -177,22 +178,17 @@ func (frr frrV6BgpNeighbors) Test(t *testing.T) {
 		{"R4", "2001:db8:0:111::2"},
 		{"R4", "2001:db8:0:150::5"},
 	} {
-		found := false
-		timeout := 120
-
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ip bgp neighbor "+x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, ".*state = Established.*") {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp peer established for %v", x.hostname)
+			return matchErr(out, ".*state = Established.*")
+		})
+		if err != nil {
+			t.Fatalf("No bgp peer established for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -202,8 +198,6 @@ type frrV6BgpRoutes struct{ *docker.Docket }
 func (frrV6BgpRoutes) String() string { return "routes" }
 
 func (frr frrV6BgpRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -217,21 +211,17 @@ func (frr frrV6BgpRoutes) Test(t *testing.T) {
 		{"R4", "2001:db8:0:120::/64"},
 		{"R4", "2001:db8:0:222::/64"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"ip", "-6", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No bgp route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -258,7 +248,7 @@ func (frr frrV6BgpInterConnectivity) Test(t *testing.T) {
 	} {
 		err := frr.PingCmd(t, x.hostname, x.target)
 		assert.Nil(err)
-		assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
+		assertGoesFib(t, test.Ip6)
 	}
 }
 
@@ -266,32 +256,10 @@ type frrV6BgpFlap struct{ *docker.Docket }
 
 func (frrV6BgpFlap) String() string { return "flap" }
 
-func (frr frrV6BgpFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrV6BgpFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
-		}
-	}
+func (frr frrV6BgpFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-bgp", test.Ip6)
 }
 
 type frrV6BgpAdminDown struct{ *docker.Docket }
@@ -299,23 +267,7 @@ type frrV6BgpAdminDown struct{ *docker.Docket }
 func (frrV6BgpAdminDown) String() string { return "admin-down" }
 
 func (frr frrV6BgpAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-bgp", test.Ip6)
 	AssertNoAdjacencies(t)
 }
 
@@ -418,10 +370,6 @@ type frrV6OspfNeighbors struct{ *docker.Docket }
 func (frrV6OspfNeighbors) String() string { return "neighbors" }
 
 func (frr frrV6OspfNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	timeout := 120
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -435,20 +383,17 @@ func (frr frrV6OspfNeighbors) Test(t *testing.T) {
 		{"R4", "0.0.0.3"},
 		{"R4", "0.0.0.1"},
 	} {
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ipv6 ospf6 neighbor")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.peer) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf neighbor found for %v", x.hostname)
+			return matchErr(out, x.peer)
+		})
+		if err != nil {
+			t.Fatalf("No ospf neighbor found for %v: %v",
+				x.hostname, err)
 		}
 	}
 }
@@ -458,8 +403,6 @@ type frrV6OspfRoutes struct{ *docker.Docket }
 func (frrV6OspfRoutes) String() string { return "routes" }
 
 func (frr frrV6OspfRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	test.Pause.Prompt("Check IPv6 OSPF routes")
 
 	for _, x := range []struct {
@@ -475,21 +418,17 @@ func (frr frrV6OspfRoutes) Test(t *testing.T) {
 		{"R4", "2001:db8:0:120::/64"},
 		{"R4", "2001:db8:0:222::/64"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"ip", "-6", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No ospf route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -515,7 +454,7 @@ func (frr frrV6OspfInterConnectivity) Test(t *testing.T) {
 		{"R4", "2001:db8:0:222::10"},
 	} {
 		assert.Nil(frr.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
+		assertGoesFib(t, test.Ip6)
 	}
 }
 
@@ -523,32 +462,10 @@ type frrV6OspfFlap struct{ *docker.Docket }
 
 func (frrV6OspfFlap) String() string { return "flap" }
 
-func (frr frrV6OspfFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrV6OspfFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
-		}
-	}
+func (frr frrV6OspfFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-ospf", test.Ip6)
 }
 
 type frrV6OspfAdminDown struct{ *docker.Docket }
@@ -556,23 +473,7 @@ type frrV6OspfAdminDown struct{ *docker.Docket }
 func (frrV6OspfAdminDown) String() string { return "admin-down" }
 
 func (frr frrV6OspfAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-ospf", test.Ip6)
 	AssertNoAdjacencies(t)
 }
 
@@ -648,8 +549,6 @@ type frrV6IsisNeighbors struct{ *docker.Docket }
 func (frrV6IsisNeighbors) String() string { return "neighbors" }
 
 func (frr frrV6IsisNeighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	test.Pause.Prompt("stop")
 
 	for _, x := range []struct {
@@ -665,22 +564,17 @@ func (frr frrV6IsisNeighbors) Test(t *testing.T) {
 		{"R4", "R3"},
 		{"R4", "R1"},
 	} {
-		timeout := 60
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show isis neighbor "+x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, "State: Up") {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No isis neighbor for %v: %v",
-				x.hostname, x.peer)
+			return matchErr(out, "State: Up")
+		})
+		if err != nil {
+			t.Fatalf("No isis neighbor for %v: %v: %v",
+				x.hostname, x.peer, err)
 		}
 	}
 }
@@ -690,8 +584,6 @@ type frrV6IsisRoutes struct{ *docker.Docket }
 func (frrV6IsisRoutes) String() string { return "routes" }
 
 func (frr frrV6IsisRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -705,21 +597,17 @@ func (frr frrV6IsisRoutes) Test(t *testing.T) {
 		{"R4", "2001:db8:0:120::/64"},
 		{"R4", "2001:db8:0:222::/64"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := frr.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ipv6 route isis")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No isis route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No isis route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -745,7 +633,7 @@ func (frr frrV6IsisInterConnectivity) Test(t *testing.T) {
 		{"R4", "2001:db8:0:222::10"},
 	} {
 		assert.Nil(frr.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
+		assertGoesFib(t, test.Ip6)
 	}
 }
 
@@ -753,32 +641,10 @@ type frrV6IsisFlap struct{ *docker.Docket }
 
 func (frrV6IsisFlap) String() string { return "flap" }
 
-func (frr frrV6IsisFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (frrV6IsisFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
-		}
-	}
+func (frr frrV6IsisFlap) Test(t *testing.T) {
+	flapConvergence(t, frr.Docket, "frr-isis", test.Ip6)
 }
 
 type frrV6IsisAdminDown struct{ *docker.Docket }
@@ -786,22 +652,6 @@ type frrV6IsisAdminDown struct{ *docker.Docket }
 func (frrV6IsisAdminDown) String() string { return "admin-down" }
 
 func (frr frrV6IsisAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range frr.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := frr.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, frr.Docket, "frr-isis", test.Ip6)
 	AssertNoAdjacencies(t)
 }
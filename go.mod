@@ -5,6 +5,7 @@ require (
 	github.com/platinasystems/test v1.8.3
 	github.com/stretchr/testify v1.3.0 // indirect
 	golang.org/x/sys v0.0.0-20190529164535-6a60838ec259 // indirect
+	gopkg.in/yaml.v2 v2.2.1
 )
 
-go 1.13
+go 1.14
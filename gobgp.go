@@ -14,29 +14,25 @@ import (
 )
 
 func gobgpNetTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	gobgpTest(t, "testdata/gobgp/ebgp/conf.yaml.tmpl")
 	test.SkipIfDryRun(t)
 }
 
 func gobgpVlanTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	gobgpTest(t, "testdata/gobgp/ebgp/vlan/conf.yaml.tmpl")
 	test.SkipIfDryRun(t)
 }
 
 func gobgpTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		gobgpConnectivity{docket},
 		gobgpDaemon{docket},
 		gobgpNeighbors{docket},
 		gobgpRoutes{docket},
+		fibConsistency{docket},
 		gobgpInterConnectivity{docket},
+		offload{docket, "R1", "R3", "192.168.222.2", nil},
 		gobgpFlap{docket},
 		gobgpAdminDown{docket})
 }
@@ -83,34 +79,22 @@ func (gobgp gobgpDaemon) Test(t *testing.T) {
 	fail := false
 	for _, r := range gobgp.Routers {
 		assert.Comment("ing gobgp on", r.Hostname)
-		out, err := gobgp.ExecCmd(t, r.Hostname, "ps", "ax")
-		assert.Nil(err)
-		//assert.Match(out, ".*gobgpd.*")
-		//assert.Match(out, ".*zebra.*")
-		timeout := 5 //for some reason, R4 gobpg takes longer to come up sometimes
-		found := false
-		for i := timeout; i > 0; i-- {
-			if !assert.MatchNonFatal(out, ".*gobgpd.*") {
-				if *test.VV {
-					fmt.Printf("%v ps ax, no match on gobgpd, %v retries left\n", r.Hostname, i-1)
-					fmt.Printf("%v\n", out)
-				}
-				time.Sleep(2 * time.Second)
-				out, err = gobgp.ExecCmd(t, r.Hostname, "ps", "ax")
-				continue
+		// for some reason, R4 gobgp takes longer to come up sometimes
+		err := poll{
+			Timeout:  10 * time.Second,
+			Interval: 2 * time.Second,
+		}.Eventually(func() error {
+			out, err := gobgp.ExecCmd(t, r.Hostname, "ps", "ax")
+			if err != nil {
+				return err
 			}
-			if !assert.MatchNonFatal(out, ".*zebra.*") {
-				if *test.VV {
-					fmt.Printf("%v ps ax, no match on zebra, %v retries left\n", r.Hostname, i-1)
-					fmt.Printf("%v\n", out)
-				}
-				out, err = gobgp.ExecCmd(t, r.Hostname, "ps", "ax")
-				time.Sleep(2 * time.Second)
-				continue
+			if err = matchErr(out, ".*gobgpd.*"); err != nil {
+				return err
 			}
-			found = true
-		}
-		if !found {
+			return matchErr(out, ".*zebra.*")
+		})
+		if err != nil {
+			t.Log(r.Hostname, err)
 			fail = true
 		}
 	}
@@ -142,25 +126,19 @@ func (gobgp gobgpNeighbors) Test(t *testing.T) {
 		{"R4", "192.168.111.2"},
 		{"R4", "192.168.150.5"},
 	} {
-		found := false
-		timeout := 120
-
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := gobgp.ExecCmd(t, x.hostname,
 				"/root/gobgp", "neighbor", x.peer)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out,
-				".*state = established.*") {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
+			return matchErr(out, ".*state = established.*")
+		})
+		if err != nil {
+			t.Fatalf("No bgp peer established for %v: %v",
+				x.hostname, err)
 		}
-		if !found {
-			t.Fatalf("No bgp peer established for %v", x.hostname)
-		}
-		_, err := gobgp.ExecCmd(t, x.hostname,
+		_, err = gobgp.ExecCmd(t, x.hostname,
 			"/root/gobgp", "global", "rib")
 		assert.Nil(err)
 	}
@@ -171,8 +149,6 @@ type gobgpRoutes struct{ *docker.Docket }
 func (gobgpRoutes) String() string { return "routes" }
 
 func (gobgp gobgpRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -201,21 +177,17 @@ func (gobgp gobgpRoutes) Test(t *testing.T) {
 		{"R4", "192.168.1.10/32"},
 		{"R4", "192.168.2.2/32"},
 	} {
-		found := false
-		timeout := 60
-		for i := timeout; i > 0; i-- {
+		err := eventually(60*time.Second, func() error {
 			out, err := gobgp.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ip route "+x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No bgp route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No bgp route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -261,7 +233,7 @@ func (gobgp gobgpInterConnectivity) Test(t *testing.T) {
 		{"R4", "192.168.2.2"},
 	} {
 		assert.Nil(gobgp.PingCmd(t, x.hostname, x.target))
-		assert.Program(*Goes, "fe1", "switch", "fib")
+		assertGoesFib(t, test.Ip4)
 	}
 }
 
@@ -269,28 +241,10 @@ type gobgpFlap struct{ *docker.Docket }
 
 func (gobgpFlap) String() string { return "flap" }
 
-func (gobgp gobgpFlap) Test(t *testing.T) {
-	assert := test.Assert{t}
+func (gobgpFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range gobgp.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := gobgp.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = gobgp.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (gobgp gobgpFlap) Test(t *testing.T) {
+	flapConvergence(t, gobgp.Docket, "gobgp", test.Ip4)
 }
 
 type gobgpAdminDown struct{ *docker.Docket }
@@ -298,22 +252,6 @@ type gobgpAdminDown struct{ *docker.Docket }
 func (gobgpAdminDown) String() string { return "admin-down" }
 
 func (gobgp gobgpAdminDown) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	num_intf := 0
-	for _, r := range gobgp.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := gobgp.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, gobgp.Docket, "gobgp", test.Ip4)
 	AssertNoAdjacencies(t)
 }
@@ -0,0 +1,130 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/fe1cli"
+	"github.com/platinasystems/test"
+)
+
+// hwTables is a snapshot of the switch tables keyed by entry identity. The
+// identity excludes hardware indices so that entries reprogrammed at a
+// different index aren't mistaken for leaks.
+type hwTables map[string]map[string]string
+
+// hwSnapshot returns the adjacency, FIB, neighbor, and per-pipe L3 tables.
+// Tables that couldn't be retrieved or parsed are logged and omitted so that
+// they aren't compared.
+func hwSnapshot(t *testing.T) hwTables {
+	t.Helper()
+	tables := make(hwTables)
+	add := func(name string, err error, entries map[string]string) {
+		if err != nil {
+			t.Log("snapshot", name, err)
+			return
+		}
+		tables[name] = entries
+	}
+	adjs, err := goesAdjacencies()
+	entries := make(map[string]string)
+	for _, adj := range adjs {
+		entries[fmt.Sprint(adj.Ifname, " ", adj.MAC, " ", adj.Vlan,
+			" hard=", adj.Hard, " l3_unicast=", adj.L3Unicast)] =
+			fmt.Sprintf("%+v", adj)
+	}
+	add("adj", err, entries)
+	for _, family := range []string{test.Ip4, test.Ip6} {
+		fib, err := goesFib(family)
+		entries := make(map[string]string)
+		for _, entry := range fib {
+			entries[fmt.Sprint(entry.Table, " ", entry.Prefix,
+				" ", entry.Kind, " ", entry.Ifname, " ",
+				entry.Gateways())] = fmt.Sprintf("%+v", entry)
+		}
+		add("fib"+family, err, entries)
+	}
+	neighbors, err := goesNeighbors()
+	entries = make(map[string]string)
+	for _, neighbor := range neighbors {
+		entries[fmt.Sprint(neighbor.Netns, " ", neighbor.Address, " ",
+			neighbor.MAC, " ", neighbor.Ifname)] =
+			fmt.Sprintf("%+v", neighbor)
+	}
+	add("neigh", err, entries)
+	for pipe := 0; pipe < fe1cli.Pipes; pipe++ {
+		iifs, err := goesL3Iifs(pipe)
+		entries := make(map[string]string)
+		for _, iif := range iifs {
+			entries[fmt.Sprint(iif.Ifname, " class_id=",
+				iif.ClassID, " vrf=", iif.Vrf)] =
+				fmt.Sprintf("%+v", iif)
+		}
+		add(fmt.Sprint("l3 pipe ", pipe), err, entries)
+	}
+	return tables
+}
+
+// leaks returns the entries of the later snapshot that weren't in this one.
+func (before hwTables) leaks(after hwTables) []string {
+	var leaks []string
+	for name, entries := range after {
+		prior, found := before[name]
+		if !found {
+			continue
+		}
+		for k, v := range entries {
+			if _, found := prior[k]; !found {
+				leaks = append(leaks, name+": "+v)
+			}
+		}
+	}
+	sort.Strings(leaks)
+	return leaks
+}
+
+// assertNoLeaks compares a new snapshot with the one taken before the test
+// and reports each additional entry as a leak. Since the switch flushes
+// tables asynchronously, this retries for a while before failing.
+func assertNoLeaks(t *testing.T, before hwTables) {
+	t.Helper()
+	var leaks []string
+	err := eventually(5*time.Second, func() error {
+		leaks = before.leaks(hwSnapshot(t))
+		if len(leaks) > 0 {
+			if *test.VV {
+				t.Log(len(leaks), "leaked entries")
+			}
+			return fmt.Errorf("%d leaked entries", len(leaks))
+		}
+		return nil
+	})
+	if err == nil {
+		return
+	}
+	t.Errorf("%d leaked hardware entries\n\t%s", len(leaks),
+		strings.Join(leaks, "\n\t"))
+}
+
+func goesL3Iifs(pipe int) (fe1cli.L3Iifs, error) {
+	out, err := goesL3Output(pipe)
+	if err != nil {
+		return nil, err
+	}
+	return fe1cli.ParseL3Iifs(pipe, out)
+}
+
+func goesL3Output(pipe int) (string, error) {
+	out, err := exec.Command(*Goes, "vnet", "show", "fe1", "l3", "pipe",
+		strconv.Itoa(pipe)).Output()
+	return string(out), err
+}
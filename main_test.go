@@ -5,14 +5,13 @@
 package main
 
 import (
-	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/platinasystems/test"
 	"github.com/platinasystems/test/ethtool"
@@ -26,6 +25,7 @@ func TestMain(m *testing.M) {
 			fmt.Fprintln(os.Stderr, r)
 			ecode = 1
 		}
+		runAtExit()
 		if *XethStat {
 			showXethStats()
 		}
@@ -34,6 +34,36 @@ func TestMain(m *testing.M) {
 		}
 	}()
 	assertFlags()
+	if err := checkTags(); err != nil {
+		panic(err)
+	}
+	if err := checkPolicy(); err != nil {
+		panic(err)
+	}
+	if *ListTags {
+		flag.Set("test.dryrun", "true")
+	}
+	if *Preflight {
+		ecode = preflight()
+		return
+	}
+	if len(*Discover) > 0 {
+		ecode = discover(*Discover)
+		return
+	}
+	if *Sweep {
+		ecode = sweep()
+		return
+	}
+	if exportResults() {
+		flag.Set("test.v", "true")
+		results.Header.Start = time.Now()
+		restore := results.teeStdout()
+		defer func() {
+			restore()
+			results.write()
+		}()
+	}
 	if *test.DryRun {
 		m.Run()
 		return
@@ -41,33 +71,38 @@ func TestMain(m *testing.M) {
 	if os.Geteuid() != 0 {
 		panic("you aren't root")
 	}
-	if b, err := ioutil.ReadFile("/proc/net/unix"); err == nil {
-		for _, atsock := range []string{
-			"@xeth",
-		} {
-			if bytes.Index(b, []byte(atsock)) < 0 {
-				panic(fmt.Errorf("no %s, are modules loaded?",
-					atsock))
-			}
-		}
-		for _, atsock := range []string{
-			"@redisd",
-			"@redis.reg",
-			"@redis.pub",
-			"@fe1",
-		} {
-			if bytes.Index(b, []byte(atsock)) < 0 {
-				panic(fmt.Errorf("no %s, is goes running?",
-					atsock))
+	if b, err := ioutil.ReadFile("/proc/net/unix"); err == nil && !*Sim {
+		for _, atsock := range uutSockets {
+			err = checkSocket(b, atsock.name, atsock.hint)
+			if err != nil {
+				panic(err)
 			}
 		}
 	}
+	undoOnSignal()
+	if *Veth {
+		addVeths()
+		release := atExit("veth pairs", delVeths)
+		defer func() {
+			delVeths()
+			release()
+		}()
+	}
 	netport.Init(*Goes)
-	ethtool.Init()
+	if !*Sim && !*Veth {
+		ethtool.Init()
+	}
 	if testing.Verbose() {
 		uutInfo()
 	}
+	startManifest()
+	if err := startCheckpoint(); err != nil {
+		panic(err)
+	}
+	telemetry.start()
 	ecode = m.Run()
+	results.setTelemetry(telemetry.Stop())
+	showGroups()
 }
 
 func Test(t *testing.T) {
@@ -94,13 +129,11 @@ func Test(t *testing.T) {
 		mayRun(t, "ping", pingBridgeTest)
 		test.SkipIfDryRun(t)
 	})
-	t.Log("Skipping nsif test")
-	if false {
-		mayRun(t, "nsif", func(t *testing.T) {
-			mayRun(t, "ip4", nsifNetTest)
-			mayRun(t, "ip6", nsifIp6NetTest)
-		})
-	}
+	mayRun(t, "nsif", func(t *testing.T) {
+		mayRun(t, "ip4", nsifNetTest)
+		mayRun(t, "ip6", nsifIp6NetTest)
+		test.SkipIfDryRun(t)
+	})
 	mayRun(t, "net6", func(t *testing.T) {
 		mayRun(t, "ping", pingIp6NetTest)
 		mayRun(t, "static", staticV6NetTest)
@@ -125,64 +158,60 @@ func Test(t *testing.T) {
 	mayRun(t, "routes", func(t *testing.T) {
 		mayRun(t, "connective", routesNetTest)
 	})
+	mayRun(t, "platform", platformTest)
 
 	test.SkipIfDryRun(t)
 }
 
+// mayRun runs the named group unless skipped by -test.policy after an
+// earlier failure, by -test.resume, or by -test.tags, then records its
+// outcome for the summary and checkpoint.
 func mayRun(t *testing.T, name string, f func(*testing.T)) bool {
-	var ret bool
 	t.Helper()
-	if !t.Failed() {
-		ret = t.Run(name, f)
-	}
-	return ret
+	reason := failureSkipReason(t)
+	return t.Run(name, func(t *testing.T) {
+		defer func() {
+			recordGroup(t, reason)
+		}()
+		if len(reason) > 0 {
+			t.Skip(reason)
+		}
+		if reason = resumeSkipReason(t.Name()); len(reason) > 0 {
+			t.Skip(reason)
+		}
+		if reason = groupSkipReason(t.Name()); len(reason) > 0 {
+			skipGroup(t, reason)
+		}
+		f(t)
+	})
 }
 
 func uutInfo() {
 	fmt.Println("---")
 	defer fmt.Println("...")
-	o, err := exec.Command(*Goes, "show", "buildid").Output()
-	if err == nil && len(o) > 0 {
-		fmt.Print(*Goes, ": |\n    buildid/", string(o))
-	}
-	pd := *PlatformDriver
-	ko := pd
-	if !strings.HasSuffix(ko, ".ko") {
-		ko += ".ko"
-	}
-	if _, err = os.Stat(ko); err == nil {
-		pd = ko
-	}
-	o, err = exec.Command("/sbin/modinfo", pd).Output()
-	if err == nil && len(o) > 0 {
-		const srcversion = "srcversion:"
-		s := string(o)
-		i := strings.Index(s, srcversion)
-		if i > 0 {
-			s = s[i+len(srcversion):]
-			i = strings.Index(s, "\n")
-			fmt.Print(pd, ": |\n    ",
-				strings.TrimLeft(s[:i+1], " \t"))
-		}
+	if buildid, err := goesBuildid(); err == nil && len(buildid) > 0 {
+		fmt.Print(*Goes, ": |\n    buildid/", buildid, "\n")
+	}
+	ko, srcversion, err := moduleSrcversion(*PlatformDriver)
+	if err == nil {
+		fmt.Print(ko, ": |\n    ", srcversion, "\n")
 	}
 }
 
 func showXethStats() {
-	const dn = "/sys/kernel/platina-mk1/xeth"
 	fmt.Println("---")
 	defer fmt.Println("...")
-	fis, err := ioutil.ReadDir(dn)
+	stats, err := xethStats()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	for _, fi := range fis {
-		bn := fi.Name()
-		b, err := ioutil.ReadFile(filepath.Join(dn, bn))
-		if err != nil {
-			fmt.Print(bn, ": ", err, "\n")
-		} else if s := string(b); s != "0\n" {
-			fmt.Print(bn, ": ", s)
-		}
+	var names []string
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Print(name, ": ", stats[name], "\n")
 	}
 }
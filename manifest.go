@@ -0,0 +1,238 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/test/ethtool"
+	"github.com/platinasystems/test/netport"
+)
+
+var (
+	Manifest = flag.String("test.manifest", "manifest.json",
+		"write the provenance of the run to this file, \"\" to disable")
+	XethModule = flag.String("test.xeth-module", "xeth",
+		"Linux Kernel xeth module")
+)
+
+// runManifest has what's needed to reproduce a run: the versions of goes,
+// the kernel and its modules, and the docker images, along with the
+// configuration files and flags.
+type runManifest struct {
+	Start         time.Time                 `json:"start"`
+	Goes          string                    `json:"goes"`
+	Buildid       string                    `json:"buildid,omitempty"`
+	Sha256        string                    `json:"sha256,omitempty"`
+	Kernel        string                    `json:"kernel,omitempty"`
+	KernelVersion string                    `json:"kernel_version,omitempty"`
+	Modules       map[string]manifestModule `json:"modules,omitempty"`
+	Images        map[string]string         `json:"images,omitempty"`
+	Files         map[string]string         `json:"files,omitempty"`
+	Flags         map[string]string         `json:"flags,omitempty"`
+	Errors        []string                  `json:"errors,omitempty"`
+}
+
+type manifestModule struct {
+	File       string `json:"file"`
+	Srcversion string `json:"srcversion"`
+}
+
+var manifest struct {
+	sync.Mutex
+	runManifest
+}
+
+// startManifest records the versions, files, and flags of this run then
+// writes the -test.manifest file. The docker images are added as each
+// docket starts.
+func startManifest() {
+	manifest.Lock()
+	defer manifest.Unlock()
+	m := &manifest.runManifest
+	m.Start = time.Now()
+	m.Goes = *Goes
+	var err error
+	fail := func(err error) {
+		m.Errors = append(m.Errors, err.Error())
+	}
+	if m.Buildid, err = goesBuildid(); err != nil {
+		fail(fmt.Errorf("buildid: %v", err))
+	}
+	if m.Sha256, err = fileSha256(*Goes); err != nil {
+		fail(err)
+	}
+	for _, x := range []struct {
+		fn string
+		p  *string
+	}{
+		{"/proc/sys/kernel/osrelease", &m.Kernel},
+		{"/proc/sys/kernel/version", &m.KernelVersion},
+	} {
+		b, err := ioutil.ReadFile(x.fn)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		*x.p = strings.TrimSpace(string(b))
+	}
+	m.Modules = make(map[string]manifestModule)
+	for _, module := range []string{*PlatformDriver, *XethModule} {
+		ko, srcversion, err := moduleSrcversion(module)
+		if err != nil {
+			fail(fmt.Errorf("%s: %v", module, err))
+			continue
+		}
+		m.Modules[module] = manifestModule{ko, srcversion}
+	}
+	m.Files = make(map[string]string)
+	for _, fn := range []string{
+		netport.NetPortFile,
+		ethtool.SettingsFile,
+		ethtool.PrivFlagsFile,
+	} {
+		b, err := ioutil.ReadFile(fn)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fail(err)
+			continue
+		}
+		m.Files[fn] = string(b)
+	}
+	m.Flags = make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		m.Flags[f.Name] = f.Value.String()
+	})
+	m.write()
+}
+
+// addManifestImages records the digest of each docker image of the template.
+func addManifestImages(tmpl string) {
+	images, err := tmplImages(tmpl)
+	manifest.Lock()
+	defer manifest.Unlock()
+	m := &manifest.runManifest
+	if err != nil {
+		m.Errors = append(m.Errors, err.Error())
+		return
+	}
+	if m.Images == nil {
+		m.Images = make(map[string]string)
+	}
+	added := false
+	for _, image := range images {
+		if _, found := m.Images[image]; found {
+			continue
+		}
+		digest, err := imageDigest(image)
+		if err != nil {
+			m.Errors = append(m.Errors, err.Error())
+			continue
+		}
+		m.Images[image] = digest
+		added = true
+	}
+	if added {
+		m.write()
+	}
+}
+
+// getManifest returns a copy of the manifest for the results.
+func getManifest() *runManifest {
+	manifest.Lock()
+	defer manifest.Unlock()
+	if manifest.Start.IsZero() {
+		return nil
+	}
+	m := manifest.runManifest
+	return &m
+}
+
+func (m *runManifest) write() {
+	if len(*Manifest) == 0 {
+		return
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(*Manifest, b, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "manifest:", err)
+	}
+}
+
+// properties are the junit properties of the manifest less its files.
+func (m *runManifest) properties() []junitProperty {
+	props := []junitProperty{
+		{"manifest.sha256", m.Sha256},
+		{"manifest.kernel", m.Kernel},
+		{"manifest.kernel_version", m.KernelVersion},
+	}
+	srcversions := make(map[string]string)
+	for module, mod := range m.Modules {
+		srcversions[module] = mod.Srcversion
+	}
+	for _, x := range []struct {
+		prefix string
+		m      map[string]string
+	}{
+		{"manifest.module.", srcversions},
+		{"manifest.image.", m.Images},
+		{"manifest.flag.", m.Flags},
+	} {
+		var keys []string
+		for k := range x.m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			props = append(props, junitProperty{x.prefix + k, x.m[k]})
+		}
+	}
+	return props
+}
+
+func fileSha256(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// imageDigest returns the repo digest of the local image, or if it was
+// built locally and has none, its id.
+func imageDigest(image string) (string, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format",
+		"{{.Id}} {{range .RepoDigests}}{{.}} {{end}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", image, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s: no id", image)
+	}
+	if len(fields) > 1 {
+		return fields[1], nil
+	}
+	return fields[0], nil
+}
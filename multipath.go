@@ -24,9 +24,24 @@ func mpNetIp6Test(t *testing.T) {
 }
 
 func mpTest(t *testing.T, netdevs netport.NetDevs) {
+	steps := xethSteps(
+		staticRoute(netdevs),
+		pingRemotesP(netdevs),
+		removeLastRoute(netdevs),
+		pingRemotesP(netdevs),
+		pingGateways(netdevs),
+		removeRoutePingGW(netdevs),
+	)
+	if listSteps(t, steps...) {
+		return
+	}
 	test.SkipIfDryRun(t)
 	assert := test.Assert{t}
-	defer nsifDelNets(netdevs).Test(t)
+	torndown := undoCleanup(t, "netns "+t.Name(), undoNetDevs(netdevs))
+	defer func() {
+		nsifDelNets(netdevs).Test(t)
+		torndown()
+	}()
 	for i := range netdevs {
 		nd := &netdevs[i]
 		ns := nd.Netns
@@ -49,14 +64,7 @@ func mpTest(t *testing.T, netdevs netport.NetDevs) {
 			assert.Program("ip", "netns", "exec", ns, "ip", "addr", "add", dIf.Ifa, "dev", dIf.Ifname)
 		}
 	}
-	test.Tests{
-		staticRoute(netdevs),
-		pingRemotesP(netdevs),
-		removeLastRoute(netdevs),
-		pingRemotesP(netdevs),
-		pingGateways(netdevs),
-		removeRoutePingGW(netdevs),
-	}.Test(t)
+	test.Tests(steps).Test(t)
 }
 
 type staticRoute []netport.NetDev
@@ -80,33 +88,25 @@ func (pingRemotesP) String() string { return "pingRemoteP" }
 
 func (mp pingRemotesP) Test(t *testing.T) {
 	assert := test.Assert{t}
-	max_retries := 3
-	wait_time := 2 * time.Second
-	failed := false
-	for n := 0; n < max_retries; n++ {
+	err := poll{
+		Timeout:  6 * time.Second,
+		Interval: 2 * time.Second,
+		Attempts: 3,
+	}.Eventually(func() error {
 		for _, nd := range []netport.NetDev(mp) {
 			for _, r := range nd.Remotes {
-				if ok := assert.PingNonFatal(nd.Netns, r); !ok {
-					failed = true
-					if n == max_retries-1 {
-						fmt.Println(nd.Netns, "ping", r, "failed")
-						test.Pause.Prompt("ping failed")
-					}
+				if !assert.PingNonFatal(nd.Netns, r) {
+					return fmt.Errorf("%s ping %s failed",
+						nd.Netns, r)
 				}
 			}
 		}
-		if !failed {
-			break
-		}
-		if n < max_retries-1 {
-			failed = false
-			time.Sleep(wait_time)
-		}
-	}
-	if failed {
+		return nil
+	})
+	if err != nil {
 		test.Pause.Prompt("Failed")
 	}
-	assert.False(failed)
+	assert.Nil(err)
 }
 
 type removeLastRoute []netport.NetDev
@@ -164,28 +164,20 @@ func (mp removeRoutePingGW) Test(t *testing.T) {
 		}
 	}
 	// now ping the gateway
-	max_retries := 3
-	wait_time := 2 * time.Second
-	failed := false
-	for n := 0; n < max_retries; n++ {
+	err := poll{
+		Timeout:  6 * time.Second,
+		Interval: 2 * time.Second,
+		Attempts: 3,
+	}.Eventually(func() error {
 		for netns, ip := range gw {
-			if ok := assert.PingNonFatal(netns, ip); !ok {
-				failed = true
-				if n == max_retries-1 {
-					fmt.Println(netns, "ping", ip, "failed")
-				}
+			if !assert.PingNonFatal(netns, ip) {
+				return fmt.Errorf("%s ping %s failed", netns, ip)
 			}
 		}
-		if !failed {
-			break
-		}
-		if n < max_retries-1 {
-			failed = false
-			time.Sleep(wait_time)
-		}
-	}
-	if failed {
+		return nil
+	})
+	if err != nil {
 		test.Pause.Prompt("Failed")
 	}
-	assert.False(failed)
+	assert.Nil(err)
 }
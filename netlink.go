@@ -0,0 +1,154 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// linkState is the netlink state of an interface that should survive its
+// round trip through another netns.
+type linkState struct {
+	Index int
+	MTU   int
+	Flags uint32
+	Addrs []string
+}
+
+// The flags of a linkState compared after a round trip. The kernel closes
+// the devices of a deleted netns as it returns them so these lose IFF_UP
+// along with the operational flags.
+const linkFlagMask = syscall.IFF_BROADCAST | syscall.IFF_MULTICAST |
+	syscall.IFF_NOARP | syscall.IFF_PROMISC | syscall.IFF_ALLMULTI |
+	syscall.IFF_POINTOPOINT | syscall.IFF_LOOPBACK
+
+func (ls linkState) String() string {
+	return fmt.Sprintf("index %d mtu %d flags %#x addrs %v", ls.Index,
+		ls.MTU, ls.Flags&linkFlagMask, ls.Addrs)
+}
+
+// diff describes how the given state differs from this.
+func (ls linkState) diff(other linkState) error {
+	switch {
+	case ls.Index != other.Index:
+		return fmt.Errorf("index %d != %d", other.Index, ls.Index)
+	case ls.MTU != other.MTU:
+		return fmt.Errorf("mtu %d != %d", other.MTU, ls.MTU)
+	case ls.Flags&linkFlagMask != other.Flags&linkFlagMask:
+		return fmt.Errorf("flags %#x != %#x", other.Flags&linkFlagMask,
+			ls.Flags&linkFlagMask)
+	case fmt.Sprint(ls.Addrs) != fmt.Sprint(other.Addrs):
+		return fmt.Errorf("addrs %v != %v", other.Addrs, ls.Addrs)
+	}
+	return nil
+}
+
+// linkStates returns the netlink link state, by name, of the interfaces in
+// the caller's netns. The addresses exclude IPv6 link-local since these come
+// and go with IFF_UP.
+func linkStates() (map[string]linkState, error) {
+	msgs, err := netlinkDump(syscall.RTM_GETLINK)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]linkState)
+	names := make(map[int]string)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWLINK ||
+			len(m.Data) < syscall.SizeofIfInfomsg {
+			continue
+		}
+		ifi := (*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		ls := linkState{
+			Index: int(ifi.Index),
+			Flags: ifi.Flags,
+		}
+		var name string
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.IFLA_IFNAME:
+				name = nulTerminated(a.Value)
+			case syscall.IFLA_MTU:
+				if len(a.Value) >= 4 {
+					ls.MTU = int(nativeEndian.Uint32(a.Value))
+				}
+			}
+		}
+		states[name] = ls
+		names[ls.Index] = name
+	}
+	if msgs, err = netlinkDump(syscall.RTM_GETADDR); err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR ||
+			len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		var ip net.IP
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.IFA_ADDRESS:
+				if ip == nil {
+					ip = net.IP(a.Value)
+				}
+			case syscall.IFA_LOCAL:
+				ip = net.IP(a.Value)
+			}
+		}
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		name, found := names[int(ifa.Index)]
+		if !found {
+			continue
+		}
+		ls := states[name]
+		ls.Addrs = append(ls.Addrs,
+			fmt.Sprint(ip, "/", ifa.Prefixlen))
+		sort.Strings(ls.Addrs)
+		states[name] = ls
+	}
+	return states, nil
+}
+
+func netlinkDump(proto int) ([]syscall.NetlinkMessage, error) {
+	b, err := syscall.NetlinkRIB(proto, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("netlink: %v", err)
+	}
+	return syscall.ParseNetlinkMessage(b)
+}
+
+func nulTerminated(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
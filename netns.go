@@ -0,0 +1,62 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// inNetns calls f from a thread in the named network namespace, i.e. a
+// docker router's hostname or a netport netns. Sockets opened by f remain in
+// that namespace after return so these may then be used from any goroutine.
+func inNetns(netns string, f func() error) error {
+	ch := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		self, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net",
+			os.Getpid(), syscall.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			ch <- err
+			return
+		}
+		defer self.Close()
+		ns, err := os.Open(filepath.Join("/var/run/netns", netns))
+		if err != nil {
+			runtime.UnlockOSThread()
+			ch <- err
+			return
+		}
+		defer ns.Close()
+		if err = setns(ns); err != nil {
+			runtime.UnlockOSThread()
+			ch <- fmt.Errorf("%s: %v", netns, err)
+			return
+		}
+		err = f()
+		if rerr := setns(self); rerr != nil {
+			// leave the thread locked so that it exits with this
+			// goroutine rather than run others in the wrong netns
+			ch <- rerr
+			return
+		}
+		runtime.UnlockOSThread()
+		ch <- err
+	}()
+	return <-ch
+}
+
+func setns(f *os.File) error {
+	_, _, e := syscall.RawSyscall(sysSetns, f.Fd(),
+		syscall.CLONE_NEWNET, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+// The syscall package doesn't define SYS_SETNS for arm64.
+const sysSetns = 268
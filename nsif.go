@@ -5,19 +5,25 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strings"
 	"testing"
 	"time"
 
+	"github.com/platinasystems/goes-platina-mk1-blackbox/fe1cli"
 	"github.com/platinasystems/test"
 	"github.com/platinasystems/test/netport"
 )
 
+var NsifCycles = flag.Int("test.nsif-cycles", 3,
+	"times to move xeth into netns then delete the netns")
+
+// How long to wait for the interfaces of a deleted netns to return.
+const nsifReturnTimeout = 10 * time.Second
+
 func nsifNetTest(t *testing.T) {
 	nsifTest(t, netport.OneNet)
 }
@@ -27,31 +33,62 @@ func nsifIp6NetTest(t *testing.T) {
 }
 
 func nsifTest(t *testing.T, netdevs netport.NetDevs) {
+	if *ListTags {
+		listTest(t.Name(), pathTags(t.Name(), false), "")
+		return
+	}
 	test.SkipIfDryRun(t)
 	assert := test.Assert{t}
-	defer nsifDelNets(netdevs).Test(t)
+	torndown := undoCleanup(t, "netns "+t.Name(), undoNetDevs(netdevs))
+	defer func() {
+		nsifDelNets(netdevs).Test(t)
+		torndown()
+	}()
 	for i := range netdevs {
 		nd := &netdevs[i]
+		nd.Ifname = netport.PortByNetPort[nd.NetPort]
+	}
+	states, err := linkStates()
+	assert.Nil(err)
+	for _, nd := range netdevs {
+		if _, found := states[nd.Ifname]; !found {
+			t.Fatal("no", nd.Ifname, "in the default netns")
+		}
+	}
+	for i := 0; i < *NsifCycles && !t.Failed(); i++ {
+		t.Run(fmt.Sprint("cycle", i), func(t *testing.T) {
+			test.Tests(xethSteps(
+				nsifAddNets(netdevs),
+				nsifPing(netdevs),
+				nsifNeighbor(netdevs),
+				nsifDelNets(netdevs),
+				nsifReturned{netdevs, states},
+				nsifNoNeighbor(netdevs),
+			)).Test(t)
+		})
+	}
+}
+
+// nsifAddNets moves each xeth into its netns with its address.
+type nsifAddNets []netport.NetDev
+
+func (nsifAddNets) String() string { return "add-netns" }
+
+func (nsif nsifAddNets) Test(t *testing.T) {
+	assert := test.Assert{t}
+	for _, nd := range []netport.NetDev(nsif) {
 		ns := nd.Netns
 		_, err := os.Stat(filepath.Join("/var/run/netns", ns))
 		if err != nil {
 			assert.Program("ip", "netns", "add", ns)
 		}
-		ifname := netport.PortByNetPort[nd.NetPort]
-		nd.Ifname = ifname
 		family := test.IpFamily(nd.Ifa)
-		assert.Program("ip", "link", "set", ifname, "up",
+		assert.Program("ip", "link", "set", nd.Ifname, "up",
 			"netns", ns)
 		assert.Program("ip", "netns", "exec", ns,
 			"ip", family, "address", "add", nd.Ifa,
-			"dev", ifname)
+			"dev", nd.Ifname)
 	}
-	test.Tests{
-		nsifPing(netdevs),
-		nsifNeighbor(netdevs),
-		nsifDelNets(netdevs),
-		nsifNoNeighbor(netdevs),
-	}.Test(t)
 }
 
 type nsifPing []netport.NetDev
@@ -67,43 +104,77 @@ func (nsif nsifPing) Test(t *testing.T) {
 	}
 }
 
+// nsifNeighbor verifies that the neighbor of each remote is both in the
+// xeth table and programmed in hardware as a host route and rewrite.
 type nsifNeighbor []netport.NetDev
 
 func (nsifNeighbor) String() string { return "neighbor" }
 
 func (nsif nsifNeighbor) Test(t *testing.T) {
 	assert := test.Assert{t}
-	retries := 3
-	var not_found bool
-	//FIXME, this is just the xeth, not necessary what got added to TH
-	xargs := []string{*Goes, "fe1", "xeth", "neigh"}
-	time.Sleep(1 * time.Second)
-	for i := retries; i > 0; i-- {
-		not_found = false
-		if *test.VVV {
-			t.Log(xargs)
+	err := eventually(3*time.Second, func() error {
+		neighbors, err := goesNeighbors()
+		if err != nil {
+			return err
+		}
+		adjs, err := goesAdjacencies()
+		if err != nil {
+			return err
 		}
-		out, _ := exec.Command(xargs[0], xargs[1:]...).Output()
-		sout := strings.TrimSpace(string(out))
 		for _, nd := range []netport.NetDev(nsif) {
+			fib, err := goesFib(test.IpFamily(nd.Ifa))
+			if err != nil {
+				return err
+			}
+			tables := fib.Tables()
 			for _, r := range nd.Remotes {
-				t.Log("matching", r, "with", sout)
-				re := regexp.MustCompile(r)
-				match := re.FindAllStringSubmatch(sout, -1)
-				if len(match) == 0 {
-					not_found = true
+				neighbor, found := neighbors.Find(r)
+				if !found {
+					return fmt.Errorf("no xeth neighbor %s", r)
+				}
+				err = hwNeighbor(tables[nd.Netns], adjs, neighbor)
+				if err != nil {
+					return err
 				}
 			}
 		}
-		if not_found && *test.VV {
-			t.Log(i-1, "retries left\n", sout)
+		return nil
+	})
+	if err != nil {
+		test.Pause.Prompt("Failed")
+	}
+	assert.Nil(err)
+}
+
+// hwNeighbor returns an error unless the table has a host route to the
+// neighbor through its interface with a hardware rewrite to its MAC.
+func hwNeighbor(table map[string]fe1cli.FibEntry, adjs fe1cli.Adjacencies,
+	neighbor fe1cli.Neighbor) error {
+	host := hostPrefix(neighbor.Address)
+	entry, found := table[host]
+	if !found {
+		return fmt.Errorf("no %s host route", host)
+	}
+	nh := fe1cli.NextHop{Address: neighbor.Address, Ifname: neighbor.Ifname}
+	if len(entry.NextHops) != 1 || entry.NextHops[0] != nh {
+		return fmt.Errorf("%s via %v not %v", host, entry.NextHops, nh)
+	}
+	for _, adj := range adjs {
+		if adj.Hard && adj.L3Unicast && adj.MAC == neighbor.MAC &&
+			adj.Ifname == neighbor.Ifname {
+			return nil
 		}
-		time.Sleep(1 * time.Second)
 	}
-	if not_found {
-		test.Pause.Prompt("Failed")
-		assert.Nil(fmt.Errorf("no neighbor found"))
+	return fmt.Errorf("no %s %s rewrite", neighbor.Ifname, neighbor.MAC)
+}
+
+// hostPrefix returns the /32 or /128 prefix of an address.
+func hostPrefix(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip.To4() != nil {
+		return ip.String() + "/32"
 	}
+	return ip.String() + "/128"
 }
 
 // delete namespace without first moving interface(s) out to default ns
@@ -123,34 +194,62 @@ func (nsif nsifDelNets) Test(t *testing.T) {
 	}
 }
 
+// nsifReturned verifies, via netlink, that each xeth is back in the default
+// netns with its original state.
+type nsifReturned struct {
+	netdevs netport.NetDevs
+	states  map[string]linkState
+}
+
+func (nsifReturned) String() string { return "returned" }
+
+func (nsif nsifReturned) Test(t *testing.T) {
+	err := eventually(nsifReturnTimeout, func() error {
+		states, err := linkStates()
+		if err != nil {
+			return err
+		}
+		for _, nd := range nsif.netdevs {
+			ls, found := states[nd.Ifname]
+			if !found {
+				return fmt.Errorf("%s not in the default netns",
+					nd.Ifname)
+			}
+			if err = nsif.states[nd.Ifname].diff(ls); err != nil {
+				return fmt.Errorf("%s: %v", nd.Ifname, err)
+			}
+		}
+		return nil
+	})
+	test.Assert{t}.Nil(err)
+}
+
+// nsifNoNeighbor verifies that the neighbors of each remote are gone from
+// the xeth table and hardware.
 type nsifNoNeighbor []netport.NetDev
 
 func (nsifNoNeighbor) String() string { return "no-neighbor" }
 
 func (nsif nsifNoNeighbor) Test(t *testing.T) {
 	assert := test.Assert{t}
-	//FIXME, this is just the xeth, not necessary what got added to TH
-	xargs := []string{*Goes, "fe1", "xeth", "neigh"}
-	if *test.VVV {
-		t.Log(xargs)
-	}
-	out, _ := exec.Command(xargs[0], xargs[1:]...).Output()
-	sout := strings.TrimSpace(string(out))
-	found := false
+	neighbors, err := goesNeighbors()
+	assert.Nil(err)
+	var leftover []fe1cli.Neighbor
 	for _, nd := range []netport.NetDev(nsif) {
+		fib, err := goesFib(test.IpFamily(nd.Ifa))
+		assert.Nil(err)
+		table := fib.Tables()[nd.Netns]
 		for _, r := range nd.Remotes {
-			re := regexp.MustCompile(r)
-			match := re.FindAllStringSubmatch(sout, -1)
-			if len(match) > 0 {
-				found = true
+			if neighbor, found := neighbors.Find(r); found {
+				leftover = append(leftover, neighbor)
+			}
+			if entry, found := table[hostPrefix(r)]; found {
+				t.Errorf("leftover host route %+v", entry)
 			}
 		}
 	}
-	if found {
-		if *test.VV {
-			t.Log(sout)
-		}
-		assert.Nil(fmt.Errorf("leftover neighbor found"))
+	if len(leftover) > 0 {
+		assert.Nil(fmt.Errorf("leftover neighbor found %+v", leftover))
 	}
 	// check leftover adjacencies as well
 	AssertNoAdjacencies(t)
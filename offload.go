@@ -0,0 +1,187 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/docker"
+)
+
+var (
+	PuntThreshold = flag.Float64("test.punt-threshold", 0.01,
+		"fail offload steps that punt more than this fraction to the CPU")
+	HwRxCounter = flag.String("test.hw-rx-counter",
+		`^port[._]rx[._]packets$`,
+		"pattern of the ethtool -S switch port receive counter")
+)
+
+const (
+	offloadPort     = 9
+	offloadRate     = 10000
+	offloadDuration = time.Second
+)
+
+// offload sends a UDP burst from the Src router to Addr in the Dst router
+// then compares the packets that the kernel received on the xeth interfaces
+// of the Via routers, or if unset all others, with those that the switch
+// received on the same ports. The step fails if more than
+// -test.punt-threshold of the burst was punted to the CPU rather than
+// forwarded in hardware.
+type offload struct {
+	*docker.Docket
+	Src, Dst string
+	Addr     string
+	Via      []string
+}
+
+func (offload) String() string { return "offload" }
+
+// offloadCounters are the sums of the kernel and switch receive counters of
+// the transit interfaces.
+type offloadCounters struct {
+	kernel, hw uint64
+	hwFound    bool
+	xeth       map[string]string
+}
+
+func (o offload) Test(t *testing.T) {
+	assert := test.Assert{t}
+	hwRx, err := regexp.Compile(*HwRxCounter)
+	assert.Nil(err)
+
+	before, err := o.counters(hwRx)
+	assert.Nil(err)
+	r, err := trafgen{
+		Netns:    o.Src,
+		Dst:      o.Addr,
+		DstNetns: o.Dst,
+		Proto:    trafgenUDP,
+		Port:     offloadPort,
+		Rate:     offloadRate,
+		Duration: offloadDuration,
+	}.Run()
+	assert.Nil(err)
+	after, err := o.counters(hwRx)
+	assert.Nil(err)
+
+	assert.Comment("burst", r)
+	if r.Received == 0 {
+		t.Fatal("no burst datagrams received by", o.Dst)
+	}
+	punted := after.kernel - before.kernel
+	total := uint64(r.Sent)
+	if before.hwFound && after.hwFound && after.hw > before.hw {
+		total = after.hw - before.hw
+	} else {
+		t.Log("no", *HwRxCounter, "counter, using datagrams sent")
+	}
+	fraction := float64(punted) / float64(total)
+	assert.Commentf("punted %d of %d (%.4f)", punted, total, fraction)
+	deltas := xethDeltas(before.xeth, after.xeth)
+	var names []string
+	for name := range deltas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		assert.Commentf("xeth %s +%d", name, deltas[name])
+	}
+	results.metric(t, "offload "+o.Src+"->"+o.Addr,
+		map[string]interface{}{
+			"burst":    r,
+			"punted":   punted,
+			"hardware": total,
+		})
+	if fraction > *PuntThreshold {
+		t.Errorf("%s->%s punted %.4f of the burst, more than %v",
+			o.Src, o.Addr, fraction, *PuntThreshold)
+	}
+}
+
+// counters sums the receive counters of the xeth interfaces of the transit
+// routers.
+func (o offload) counters(hwRx *regexp.Regexp) (c offloadCounters, err error) {
+	for _, r := range o.Routers {
+		if !o.transit(r.Hostname) {
+			continue
+		}
+		for _, i := range r.Intfs {
+			if strings.HasPrefix(i.Name, "dummy") {
+				continue
+			}
+			intf := i.Name
+			if i.Vlan != "" {
+				intf += "." + i.Vlan
+			}
+			var n uint64
+			n, err = kernelRxPackets(r.Hostname, intf)
+			if err != nil {
+				return
+			}
+			c.kernel += n
+			// the switch counts the port, not its vlan
+			if n, found := hwRxPackets(r.Hostname, i.Name,
+				hwRx); found {
+				c.hw += n
+				c.hwFound = true
+			}
+		}
+	}
+	c.xeth, err = xethStats()
+	return
+}
+
+func (o offload) transit(hostname string) bool {
+	if len(o.Via) == 0 {
+		return hostname != o.Src && hostname != o.Dst
+	}
+	for _, via := range o.Via {
+		if via == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+func kernelRxPackets(netns, intf string) (uint64, error) {
+	out, err := exec.Command("ip", "netns", "exec", netns, "cat",
+		"/sys/class/net/"+intf+"/statistics/rx_packets").Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s %s rx_packets: %v", netns, intf, err)
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+}
+
+func hwRxPackets(netns, intf string, hwRx *regexp.Regexp) (uint64, bool) {
+	out, err := exec.Command("ip", "netns", "exec", netns, "ethtool",
+		"-S", intf).Output()
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		field := strings.SplitN(line, ":", 2)
+		if len(field) != 2 {
+			continue
+		}
+		if !hwRx.MatchString(strings.TrimSpace(field[0])) {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(field[1]), 10, 64)
+		if err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
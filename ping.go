@@ -14,7 +14,11 @@ import (
 	"github.com/platinasystems/test/netport"
 )
 
-var Flood = flag.Int("test.flood", 1, "flood ping duration in seconds")
+var (
+	Flood     = flag.Int("test.flood", 1, "flood ping duration in seconds")
+	FloodRate = flag.Int("test.flood-rate", 0,
+		"flood packets per second, 0 for maximum")
+)
 
 func pingNetTest(t *testing.T) {
 	pingTest(t, netport.TwoNets)
@@ -39,12 +43,18 @@ func pingBridgeTest(t *testing.T) {
 }
 
 func pingTest(t *testing.T, netdevs netport.NetDevs) {
-	netdevs.Test(t,
+	steps := xethSteps(
 		pingGateways(netdevs),
 		pingRemotes(netdevs),
 		pingFlood(netdevs),
 		pingRemotes(netdevs), // verify after flood ping
 	)
+	if listSteps(t, steps...) {
+		return
+	}
+	torndown := undoCleanup(t, "netdevs "+t.Name(), undoNetDevs(netdevs))
+	netdevs.Test(t, steps...)
+	torndown()
 }
 
 type pingGateways []netport.NetDev
@@ -83,10 +93,13 @@ func (pingFlood) String() string {
 	return fmt.Sprint("flood-", time.Duration(*Flood)*time.Second)
 }
 
+func (pingFlood) Tags() []string { return []string{"stress", "long"} }
+
 func (list pingFlood) Test(t *testing.T) {
-	if testing.Short() || *Flood <= 0 {
+	if *Flood <= 0 {
 		t.SkipNow()
 	}
+	defer telemetry.stress(t)()
 
 	assert := test.Assert{t}
 	nd := []netport.NetDev(list)[0]
@@ -98,10 +111,17 @@ func (list pingFlood) Test(t *testing.T) {
 	gw := nd.Routes[0].GW
 	dur := time.Duration(*Flood) * time.Second
 	assert.Ping(ns, gw)
-	p, err := test.Begin(t, dur, test.Quiet{},
-		"ip", "netns", "exec", ns,
-		"hping3", "--icmp", "--flood", "-q", "-t", 1, gw)
+	g := trafgen{
+		Netns:    ns,
+		Dst:      gw,
+		Proto:    trafgenICMP,
+		Rate:     *FloodRate,
+		Duration: dur,
+		TTL:      1,
+	}
+	r, err := g.Run()
 	assert.Nil(err)
-	p.End()
+	assert.Comment(g, r)
+	results.metric(t, "flood", r)
 	assert.Ping(ns, gw)
 }
@@ -0,0 +1,274 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/test"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	MinFanRpm = flag.Int("test.min-fan-rpm", 2000,
+		"minimum speed of each BMC fan")
+	MaxFanRpm = flag.Int("test.max-fan-rpm", 20000,
+		"maximum speed of each BMC fan")
+	MaxBmcTemp = flag.Float64("test.max-bmc-temp", 80,
+		"maximum of each BMC temperature (C)")
+	PlatformKeys = flag.String("test.platform-keys",
+		"testdata/platform.yaml",
+		"expected hget and BMC keys with the type of each value")
+	PlatformKeysUpdate = flag.Bool("test.platform-keys-update", false,
+		"rewrite -test.platform-keys from the switch and BMC")
+)
+
+func platformTest(t *testing.T) {
+	steps := xethSteps(
+		platformHget{},
+		platformFans{},
+		platformPsus{},
+		platformTemps{},
+	)
+	if listSteps(t, steps...) {
+		return
+	}
+	test.Tests(steps).Test(t)
+}
+
+// platformHget verifies that the expected keys of goes hget platina-mk1 and
+// the BMC hash exist and have values of their type.
+type platformHget struct{}
+
+func (platformHget) String() string { return "hget" }
+
+func (platformHget) Test(t *testing.T) {
+	assert := test.Assert{t}
+	b, err := ioutil.ReadFile(*PlatformKeys)
+	assert.Nil(err)
+	var keys map[string]map[string]string
+	assert.Nil(yaml.Unmarshal(b, &keys))
+
+	out, err := exec.Command(*Goes, "hget", "platina-mk1").Output()
+	assert.Nil(err)
+	hget := parseHget(string(out))
+
+	if *Sim {
+		// goes-sim answers with the expected keys, so this only
+		// checks the types of its made up values
+		if *PlatformKeysUpdate {
+			t.Fatal("can't update platform keys from simulated goes")
+		}
+		assert.Comment("skipping platina-mk1-bmc with simulated goes")
+		checkKeys(t, "platina-mk1", keys["platina-mk1"], hget)
+		return
+	}
+	c, err := getBmc()
+	assert.Nil(err)
+	m, err := c.Hgetall()
+	assert.Nil(err)
+	if *PlatformKeysUpdate {
+		assert.Nil(updatePlatformKeys(b, map[string]map[string]string{
+			"platina-mk1":     keyTypes(hget),
+			"platina-mk1-bmc": keyTypes(m),
+		}))
+		assert.Comment("updated", *PlatformKeys)
+		return
+	}
+	checkKeys(t, "platina-mk1", keys["platina-mk1"], hget)
+	checkKeys(t, "platina-mk1-bmc", keys["platina-mk1-bmc"], m)
+}
+
+// keyTypes returns the inferred type of each value; enumerations are left to
+// be edited in by hand.
+func keyTypes(m map[string]string) map[string]string {
+	types := make(map[string]string)
+	for k, v := range m {
+		types[k] = "string"
+		for _, typ := range []string{"int", "float", "mac"} {
+			if checkType(typ, v) == nil {
+				types[k] = typ
+				break
+			}
+		}
+	}
+	return types
+}
+
+// updatePlatformKeys rewrites -test.platform-keys with the given keys,
+// retaining the leading comment of the prior file.
+func updatePlatformKeys(prior []byte, keys map[string]map[string]string) error {
+	var header []string
+	for _, line := range strings.Split(string(prior), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		header = append(header, line)
+	}
+	b, err := yaml.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		b = append([]byte(strings.Join(header, "\n")+"\n"), b...)
+	}
+	return ioutil.WriteFile(*PlatformKeys, b, 0644)
+}
+
+// parseHget returns the fields of "key: value" lines.
+func parseHget(out string) map[string]string {
+	m := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) == 2 {
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return m
+}
+
+func checkKeys(t *testing.T, hash string, want, got map[string]string) {
+	t.Helper()
+	var keys []string
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, found := got[k]
+		if !found {
+			t.Errorf("%s: no %s", hash, k)
+		} else if err := checkType(want[k], v); err != nil {
+			t.Errorf("%s: %s: %v", hash, k, err)
+		}
+	}
+}
+
+// checkType returns an error if the value isn't of the named type or one of
+// the "|" separated enumeration.
+func checkType(typ, v string) (err error) {
+	switch typ {
+	case "int":
+		_, err = strconv.Atoi(v)
+	case "float":
+		_, err = strconv.ParseFloat(v, 64)
+	case "string":
+		if len(v) == 0 {
+			err = fmt.Errorf("empty")
+		}
+	case "mac":
+		_, err = net.ParseMAC(v)
+	default:
+		for _, allowed := range strings.Split(typ, "|") {
+			if v == allowed {
+				return nil
+			}
+		}
+		err = fmt.Errorf("%q not %s", v, typ)
+	}
+	return
+}
+
+// platformFans verifies that every fan tray is OK with its fans in range.
+type platformFans struct{}
+
+func (platformFans) String() string { return "fans" }
+
+func (platformFans) Test(t *testing.T) {
+	if *Sim {
+		t.Skip("no BMC with simulated goes")
+	}
+	assert := test.Assert{t}
+	c, err := getBmc()
+	assert.Nil(err)
+	trays, err := c.FanTrays()
+	assert.Nil(err)
+	if len(trays) == 0 {
+		t.Fatal("no fan trays")
+	}
+	for _, tray := range trays {
+		assert.Commentf("fan tray %d %s %v", tray.Tray, tray.Status,
+			tray.RPM)
+		if !tray.OK() {
+			t.Errorf("fan tray %d status %q", tray.Tray, tray.Status)
+		}
+		for i, rpm := range tray.RPM {
+			if rpm < *MinFanRpm || rpm > *MaxFanRpm {
+				t.Errorf("fan tray %d fan %d %d rpm not in %d..%d",
+					tray.Tray, i+1, rpm, *MinFanRpm,
+					*MaxFanRpm)
+			}
+		}
+	}
+}
+
+// platformPsus verifies that the power supplies are present and OK.
+type platformPsus struct{}
+
+func (platformPsus) String() string { return "psus" }
+
+func (platformPsus) Test(t *testing.T) {
+	if *Sim {
+		t.Skip("no BMC with simulated goes")
+	}
+	assert := test.Assert{t}
+	c, err := getBmc()
+	assert.Nil(err)
+	psus, err := c.Psus()
+	assert.Nil(err)
+	if len(psus) == 0 {
+		t.Fatal("no PSUs")
+	}
+	for _, psu := range psus {
+		assert.Commentf("psu%d %s", psu.Slot, psu.Status)
+		if !psu.Present() {
+			t.Errorf("psu%d not present", psu.Slot)
+		} else if !psu.OK() {
+			t.Errorf("psu%d status %q", psu.Slot, psu.Status)
+		}
+	}
+}
+
+// platformTemps verifies the CPU coretemp and BMC temperatures.
+type platformTemps struct{}
+
+func (platformTemps) String() string { return "temperatures" }
+
+func (platformTemps) Test(t *testing.T) {
+	assert := test.Assert{t}
+	cpu, err := getCpuTemp()
+	assert.Nil(err)
+	assert.Commentf("cpu %vC", cpu)
+	if *MaxCpuTemp > 0 && cpu > *MaxCpuTemp {
+		t.Errorf("cpu %vC exceeds %vC", cpu, *MaxCpuTemp)
+	}
+	if *Sim {
+		return
+	}
+	c, err := getBmc()
+	assert.Nil(err)
+	temps, err := c.Temperatures()
+	assert.Nil(err)
+	var names []string
+	for name := range temps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		assert.Commentf("%s %vC", name, temps[name])
+		if temps[name] > *MaxBmcTemp {
+			t.Errorf("%s %vC exceeds %vC", name, temps[name],
+				*MaxBmcTemp)
+		}
+	}
+}
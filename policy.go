@@ -0,0 +1,117 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"text/tabwriter"
+)
+
+var Policy = flag.String("test.policy", "fail-fast",
+	"after a failure: fail-fast, continue, or continue-within-group")
+
+const (
+	// failFast skips every group after the first failure.
+	failFast = "fail-fast"
+	// continueAll runs every group regardless of failures.
+	continueAll = "continue"
+	// continueWithinGroup runs the rest of the top level group, e.g.
+	// vlan4, of the first failure but skips the groups after it.
+	continueWithinGroup = "continue-within-group"
+)
+
+func checkPolicy() error {
+	switch *Policy {
+	case failFast, continueAll, continueWithinGroup:
+		return nil
+	}
+	return fmt.Errorf("-test.policy: unknown %q", *Policy)
+}
+
+// groupOutcome is the result of a group run by mayRun.
+type groupOutcome struct {
+	name   string
+	status string
+	reason string
+}
+
+// groupOutcomes records the groups in the order that they finished, so
+// subgroups before their parent.
+var groupOutcomes struct {
+	sync.Mutex
+	list         []groupOutcome
+	firstFailure string
+}
+
+func recordGroup(t *testing.T, reason string) {
+	o := groupOutcome{name: t.Name(), status: testStatus(t), reason: reason}
+	groupOutcomes.Lock()
+	defer groupOutcomes.Unlock()
+	if o.status == "FAIL" && len(groupOutcomes.firstFailure) == 0 {
+		groupOutcomes.firstFailure = o.name
+	}
+	groupOutcomes.list = append(groupOutcomes.list, o)
+	recordCheckpoint(o.name, o.status)
+}
+
+// testStatus returns the FAIL, SKIP, or PASS outcome of the test.
+func testStatus(t *testing.T) string {
+	switch {
+	case t.Failed():
+		return "FAIL"
+	case t.Skipped():
+		return "SKIP"
+	}
+	return "PASS"
+}
+
+// failureSkipReason returns why, given -test.policy, the named group of the
+// parent test is skipped after an earlier failure, or "" if it should run.
+func failureSkipReason(parent *testing.T) string {
+	if !parent.Failed() {
+		return ""
+	}
+	switch *Policy {
+	case continueAll:
+		return ""
+	case continueWithinGroup:
+		if strings.Contains(parent.Name(), "/") {
+			return ""
+		}
+	}
+	groupOutcomes.Lock()
+	defer groupOutcomes.Unlock()
+	return fmt.Sprint(*Policy, " after ", groupOutcomes.firstFailure)
+}
+
+// showGroups prints the outcome of each group in the order that these
+// started.
+func showGroups() {
+	groupOutcomes.Lock()
+	defer groupOutcomes.Unlock()
+	if len(groupOutcomes.list) == 0 {
+		return
+	}
+	list := make([]groupOutcome, len(groupOutcomes.list))
+	copy(list, groupOutcomes.list)
+	// a parent finishes after its subgroups but is listed before them
+	for i := 0; i < len(list); i++ {
+		for j := i; j > 0 &&
+			strings.HasPrefix(list[j-1].name, list[j].name+"/"); j-- {
+			list[j-1], list[j] = list[j], list[j-1]
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tRESULT\t")
+	for _, o := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", o.name, o.status, o.reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,115 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var TimeoutScale = flag.Float64("test.timeout-scale", 1,
+	"multiply polling timeouts by this factor for slow builds")
+
+// poll repeats a condition every Interval, multiplied by Backoff after each
+// attempt up to MaxInterval. A zero Interval is one second and a zero
+// Backoff is one, i.e. a fixed interval. Eventually makes at least Attempts
+// tries, even if these take longer than the Timeout.
+type poll struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	Backoff     float64
+	MaxInterval time.Duration
+	Attempts    int
+}
+
+// eventually returns nil once f returns nil within the scaled timeout with a
+// one second interval.
+func eventually(timeout time.Duration, f func() error) error {
+	return poll{Timeout: timeout}.Eventually(f)
+}
+
+// consistently returns nil if f returns nil for the whole scaled duration
+// with a one second interval.
+func consistently(duration time.Duration, f func() error) error {
+	return poll{Timeout: duration}.Consistently(f)
+}
+
+// Eventually returns nil once f returns nil or, after the scaled timeout, an
+// error wrapping the last observed failure.
+func (p poll) Eventually(f func() error) error {
+	start := time.Now()
+	timeout := p.scaled()
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		elapsed := time.Since(start)
+		if elapsed >= timeout && attempt >= p.Attempts {
+			return fmt.Errorf("not after %d attempts in %v: %w",
+				attempt, elapsed.Round(time.Millisecond), err)
+		}
+		p.sleep(attempt, timeout-elapsed)
+	}
+}
+
+// Consistently returns nil if f doesn't fail for the scaled duration or the
+// first observed failure.
+func (p poll) Consistently(f func() error) error {
+	start := time.Now()
+	duration := p.scaled()
+	for attempt := 1; ; attempt++ {
+		if err := f(); err != nil {
+			return fmt.Errorf("failed after %d attempts in %v: %w",
+				attempt, time.Since(start).Round(time.Millisecond),
+				err)
+		}
+		elapsed := time.Since(start)
+		if elapsed >= duration {
+			return nil
+		}
+		p.sleep(attempt, duration-elapsed)
+	}
+}
+
+func (p poll) scaled() time.Duration {
+	if *TimeoutScale <= 0 {
+		return p.Timeout
+	}
+	return time.Duration(float64(p.Timeout) * *TimeoutScale)
+}
+
+// sleep for the interval of the given attempt, but no longer than the time
+// remaining, if any.
+func (p poll) sleep(attempt int, remaining time.Duration) {
+	interval := p.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	if p.Backoff > 1 {
+		for i := 1; i < attempt; i++ {
+			interval = time.Duration(float64(interval) * p.Backoff)
+			if p.MaxInterval > 0 && interval >= p.MaxInterval {
+				interval = p.MaxInterval
+				break
+			}
+		}
+	}
+	if remaining > 0 && interval > remaining {
+		interval = remaining
+	}
+	time.Sleep(interval)
+}
+
+// matchErr returns an error with the given output unless it matches the
+// pattern.
+func matchErr(out, pattern string) error {
+	if !regexp.MustCompile(pattern).MatchString(out) {
+		return fmt.Errorf("%q\n\t!= @(%s)", out, pattern)
+	}
+	return nil
+}
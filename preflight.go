@@ -0,0 +1,458 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/platinasystems/test/ethtool"
+	"github.com/platinasystems/test/netport"
+	"gopkg.in/yaml.v2"
+)
+
+var Preflight = flag.Bool("test.preflight", false,
+	"check the environment, print a pass/fail table, then exit")
+
+// preflightTools are the programs run on the host by suites and their setup.
+var preflightTools = []string{"ip", "ethtool", "docker"}
+
+// preflightImageTools are the programs run in the containers of these
+// templates.
+var preflightImageTools = []struct {
+	tmpl  string
+	tools []string
+}{
+	{"testdata/net/static/conf.yaml.tmpl", []string{"iperf3"}},
+	{"testdata/net/static/vlan/conf.yaml.tmpl", []string{"iperf3"}},
+	{"testdata/net6/static/conf.yaml.tmpl", []string{"iperf3"}},
+	{"testdata/net6/static/vlan/conf.yaml.tmpl", []string{"iperf3"}},
+	{"testdata/net/dhcp/conf.yaml.tmpl", []string{"tcpdump"}},
+	{"testdata/net/dhcp/vlan/conf.yaml.tmpl", []string{"tcpdump"}},
+	{"testdata/net6/dhcp/conf.yaml.tmpl", []string{"tcpdump"}},
+	{"testdata/net6/dhcp/vlan/conf.yaml.tmpl", []string{"tcpdump"}},
+}
+
+// errSkipped marks a check that doesn't apply to this run.
+var errSkipped = errors.New("skipped")
+
+type preflightCheck struct {
+	name string
+	err  error
+}
+
+// preflight checks the environment that the suites assume, prints a table
+// of the results, and returns the exit code, 1 if any check failed.
+func preflight() int {
+	var checks []preflightCheck
+	check := func(name string, err error) {
+		checks = append(checks, preflightCheck{name, err})
+	}
+	if os.Geteuid() != 0 {
+		check("root", errors.New("you aren't root"))
+	} else {
+		check("root", nil)
+	}
+	if *Sim {
+		for _, s := range uutSockets {
+			check("socket "+s.name, errSkipped)
+		}
+	} else {
+		unix, err := ioutil.ReadFile("/proc/net/unix")
+		for _, s := range uutSockets {
+			if err == nil {
+				err = checkSocket(unix, s.name, s.hint)
+			}
+			check("socket "+s.name, err)
+		}
+	}
+	for _, tool := range preflightTools {
+		_, err := exec.LookPath(tool)
+		check("tool "+tool, err)
+	}
+	images, err := templateImages()
+	if err != nil {
+		check("docker images", err)
+	}
+	for _, image := range images {
+		check("image "+image, exec.Command("docker", "image", "inspect",
+			image).Run())
+	}
+	for _, c := range imageToolChecks() {
+		check(c.name, c.err)
+	}
+	ports, err := netportPorts()
+	if err != nil {
+		check(netport.NetPortFile, err)
+	}
+	for _, port := range ports {
+		if *Veth {
+			check("port "+port, errSkipped)
+			continue
+		}
+		_, err := os.Stat(filepath.Join("/sys/class/net", port))
+		check("port "+port, err)
+	}
+	for _, c := range ethtoolChecks() {
+		check(c.name, c.err)
+	}
+	pairs, err := netportPairs()
+	if err != nil {
+		check("cabling", err)
+	}
+	for _, pair := range pairs {
+		name := fmt.Sprint("cable ", pair[0], " <-> ", pair[1])
+		if *Veth || *Sim {
+			check(name, errSkipped)
+			continue
+		}
+		check(name, checkCable(pair[0], pair[1]))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	ecode := 0
+	fmt.Fprintln(w, "CHECK\tRESULT\t")
+	for _, c := range checks {
+		switch c.err {
+		case nil:
+			fmt.Fprintf(w, "%s\tPASS\t\n", c.name)
+		case errSkipped:
+			fmt.Fprintf(w, "%s\tSKIP\t\n", c.name)
+		default:
+			fmt.Fprintf(w, "%s\tFAIL\t%v\n", c.name, c.err)
+			ecode = 1
+		}
+	}
+	w.Flush()
+	return ecode
+}
+
+var imageRe = regexp.MustCompile(`(?m)^\s*image:\s*"?([^"\s]+)"?`)
+
+// templateImages returns the docker images of every testdata template.
+func templateImages() ([]string, error) {
+	found := make(map[string]struct{})
+	err := filepath.Walk("testdata", func(path string, fi os.FileInfo,
+		err error) error {
+		if err != nil || fi.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return err
+		}
+		images, err := tmplImages(path)
+		for _, image := range images {
+			found[image] = struct{}{}
+		}
+		return err
+	})
+	var images []string
+	for image := range found {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images, err
+}
+
+// tmplImages returns the docker images of the named template.
+func tmplImages(fn string) ([]string, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, m := range imageRe.FindAllStringSubmatch(string(b), -1) {
+		if !contains(images, m[1]) {
+			images = append(images, m[1])
+		}
+	}
+	return images, nil
+}
+
+// imageToolChecks looks for the preflightImageTools in each image of their
+// templates. Those of images that docker doesn't have are skipped.
+func imageToolChecks() []preflightCheck {
+	var checks []preflightCheck
+	checked := make(map[string]bool)
+	for _, x := range preflightImageTools {
+		images, err := tmplImages(x.tmpl)
+		if err != nil {
+			checks = append(checks, preflightCheck{x.tmpl, err})
+			continue
+		}
+		for _, image := range images {
+			for _, tool := range x.tools {
+				name := "tool " + tool + " in " + image
+				if checked[name] {
+					continue
+				}
+				checked[name] = true
+				err := exec.Command("docker", "image", "inspect",
+					image).Run()
+				if err != nil {
+					checks = append(checks,
+						preflightCheck{name, errSkipped})
+					continue
+				}
+				err = exec.Command("docker", "run", "--rm",
+					"--entrypoint", "sh", image, "-c",
+					"command -v "+tool).Run()
+				checks = append(checks, preflightCheck{name, err})
+			}
+		}
+	}
+	return checks
+}
+
+// netportMap returns the interface of each netport in netport.yaml without
+// netport.Init's checks of the interfaces.
+func netportMap() (map[string]string, error) {
+	b, err := ioutil.ReadFile(netport.NetPortFile)
+	if err != nil {
+		return nil, err
+	}
+	portByNetPort := make(map[string]string)
+	if err = yaml.Unmarshal(b, portByNetPort); err != nil {
+		return nil, fmt.Errorf("%s: %v", netport.NetPortFile, err)
+	}
+	return portByNetPort, nil
+}
+
+// netportPorts returns the interfaces of netport.yaml ordered by netport.
+func netportPorts() ([]string, error) {
+	portByNetPort, err := netportMap()
+	if err != nil {
+		return nil, err
+	}
+	var netports []string
+	for netport := range portByNetPort {
+		netports = append(netports, netport)
+	}
+	sort.Strings(netports)
+	ports := make([]string, len(netports))
+	for i, netport := range netports {
+		ports[i] = portByNetPort[netport]
+	}
+	return ports, nil
+}
+
+// ethtoolChecks compares the settings of ethtool.yaml and
+// ethtool_priv_flags.yaml with those reported by ethtool.
+func ethtoolChecks() []preflightCheck {
+	var checks []preflightCheck
+	for _, x := range []struct {
+		fn    string
+		check func(ifname, option string, args []string) error
+	}{
+		{ethtool.SettingsFile, checkEthtoolSettings},
+		{ethtool.PrivFlagsFile, checkEthtoolPrivFlags},
+	} {
+		b, err := ioutil.ReadFile(x.fn)
+		if os.IsNotExist(err) {
+			continue
+		}
+		m := make(map[string][]string)
+		if err == nil {
+			err = yaml.Unmarshal(b, m)
+		}
+		if err != nil {
+			checks = append(checks, preflightCheck{x.fn, err})
+			continue
+		}
+		option := "--set-priv-flags"
+		if opt, ok := m["option"]; ok && len(opt) > 0 {
+			option = opt[0]
+		}
+		var ifnames []string
+		for ifname := range m {
+			if ifname != "option" {
+				ifnames = append(ifnames, ifname)
+			}
+		}
+		sort.Strings(ifnames)
+		for _, ifname := range ifnames {
+			err := errSkipped
+			if !*Sim && !*Veth {
+				err = x.check(ifname, option, m[ifname])
+			}
+			checks = append(checks, preflightCheck{
+				fmt.Sprint("ethtool ", ifname, " ",
+					strings.Join(m[ifname], " ")),
+				err,
+			})
+		}
+	}
+	return checks
+}
+
+// checkEthtoolSettings compares the "ethtool -s" arguments with the
+// "ethtool" report.
+func checkEthtoolSettings(ifname, _ string, args []string) error {
+	out, err := exec.Command("ethtool", ifname).Output()
+	if err != nil {
+		return err
+	}
+	report := ethtoolReport(string(out))
+	for i := 0; i+1 < len(args); i += 2 {
+		k, v := args[i], args[i+1]
+		var field, want string
+		switch k {
+		case "speed":
+			field, want = "Speed", v+"Mb/s"
+		case "autoneg":
+			field, want = "Auto-negotiation", v
+		case "duplex":
+			field, want = "Duplex", strings.Title(v)
+		case "port":
+			field, want = "Port", map[string]string{
+				"tp":    "Twisted Pair",
+				"aui":   "AUI",
+				"bnc":   "BNC",
+				"mii":   "MII",
+				"fibre": "FIBRE",
+				"da":    "Direct Attach Copper",
+			}[v]
+		default:
+			continue
+		}
+		if got := report[field]; !strings.EqualFold(got, want) {
+			return fmt.Errorf("%s %q, want %q", field, got, want)
+		}
+	}
+	return nil
+}
+
+// checkEthtoolPrivFlags compares the "ethtool --set-priv-flags" or
+// "--set-fec" arguments with the respective report.
+func checkEthtoolPrivFlags(ifname, option string, args []string) error {
+	show := strings.Replace(option, "--set-", "--show-", 1)
+	out, err := exec.Command("ethtool", show, ifname).Output()
+	if err != nil {
+		return err
+	}
+	report := ethtoolReport(string(out))
+	for i := 0; i+1 < len(args); i += 2 {
+		k, v := args[i], args[i+1]
+		if option == "--set-fec" && k == "encoding" {
+			got := report["Active FEC encoding"]
+			if len(got) == 0 {
+				got = report["Configured FEC encodings"]
+			}
+			if !strings.Contains(strings.ToLower(got),
+				strings.ToLower(v)) {
+				return fmt.Errorf("FEC %q, want %q", got, v)
+			}
+			continue
+		}
+		if got := report[k]; got != v {
+			return fmt.Errorf("%s %q, want %q", k, got, v)
+		}
+	}
+	return nil
+}
+
+// ethtoolReport returns the "field: value" lines of ethtool output.
+func ethtoolReport(out string) map[string]string {
+	report := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			report[strings.TrimSpace(kv[0])] =
+				strings.TrimSpace(kv[1])
+		}
+	}
+	return report
+}
+
+// checkCable verifies that the ports are cabled to each other by bouncing
+// the first and watching the carrier of the second. The admin state of
+// both ports is restored.
+func checkCable(port0, port1 string) error {
+	for _, port := range []string{port0, port1} {
+		up, err := linkAdminUp(port)
+		if err != nil {
+			return err
+		}
+		if !up {
+			if err = ipLinkSet(port, "up"); err != nil {
+				return err
+			}
+			defer ipLinkSet(port, "down")
+		}
+	}
+	carrier := func(want bool) func() error {
+		return func() error {
+			for _, port := range []string{port0, port1} {
+				if got := linkCarrier(port); got != want {
+					return fmt.Errorf("%s carrier %v",
+						port, got)
+				}
+			}
+			return nil
+		}
+	}
+	if err := eventually(10*time.Second, carrier(true)); err != nil {
+		return fmt.Errorf("no link: %v", err)
+	}
+	if err := ipLinkSet(port0, "down"); err != nil {
+		return err
+	}
+	err := eventually(5*time.Second, func() error {
+		if linkCarrier(port1) {
+			return fmt.Errorf("%s carrier with %s down", port1,
+				port0)
+		}
+		return nil
+	})
+	if uerr := ipLinkSet(port0, "up"); err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return fmt.Errorf("not cabled to each other: %v", err)
+	}
+	return eventually(10*time.Second, func() error {
+		if !linkCarrier(port1) {
+			return fmt.Errorf("%s no carrier after %s up", port1,
+				port0)
+		}
+		return nil
+	})
+}
+
+func linkAdminUp(ifname string) (bool, error) {
+	b, err := ioutil.ReadFile(filepath.Join("/sys/class/net", ifname,
+		"flags"))
+	if err != nil {
+		return false, err
+	}
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(b)), 0, 32)
+	return flags&syscall.IFF_UP != 0, err
+}
+
+// linkCarrier is false for down links, i.e. when carrier can't be read.
+func linkCarrier(ifname string) bool {
+	b, err := ioutil.ReadFile(filepath.Join("/sys/class/net", ifname,
+		"carrier"))
+	return err == nil && strings.TrimSpace(string(b)) == "1"
+}
+
+func ipLinkSet(ifname, state string) error {
+	out, err := exec.Command("ip", "link", "set", ifname,
+		state).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", ifname, state, err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	ResultsXml = flag.String("test.results-xml", "",
+		"write JUnit XML results to this file")
+	ResultsJson = flag.String("test.results-json", "",
+		"write JSON results to this file")
+)
+
+// result is the outcome of a test or subtest step.
+type result struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+	Comments []string      `json:"comments,omitempty"`
+	Failures []string      `json:"failures,omitempty"`
+
+	Metrics map[string]interface{} `json:"metrics,omitempty"`
+}
+
+// runHeader identifies the unit under test.
+type runHeader struct {
+	Start      time.Time         `json:"start"`
+	Goes       string            `json:"goes"`
+	Buildid    string            `json:"buildid,omitempty"`
+	Driver     string            `json:"driver"`
+	Srcversion string            `json:"srcversion,omitempty"`
+	XethStats  map[string]string `json:"xeth_stats,omitempty"`
+}
+
+// runResults collects the step results by scanning the verbose test output.
+type runResults struct {
+	mu        sync.Mutex
+	Header    runHeader         `json:"header"`
+	Results   []*result         `json:"results"`
+	Telemetry []telemetrySample `json:"telemetry,omitempty"`
+	Manifest  *runManifest      `json:"manifest,omitempty"`
+	byName    map[string]*result
+	current   *result
+}
+
+var results runResults
+
+// exportResults returns true if either results file was requested.
+func exportResults() bool {
+	return len(*ResultsXml) > 0 || len(*ResultsJson) > 0
+}
+
+// teeStdout replaces os.Stdout with a pipe that is copied to the original
+// while scanned for test results. The returned function restores os.Stdout
+// and waits for the scan to finish.
+func (rr *runResults) teeStdout() func() {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	os.Stdout = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(io.TeeReader(r, stdout))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			rr.scan(scanner.Text())
+		}
+		io.Copy(stdout, r)
+	}()
+	return func() {
+		os.Stdout = stdout
+		w.Close()
+		<-done
+		r.Close()
+	}
+}
+
+func (rr *runResults) get(name string) *result {
+	if rr.byName == nil {
+		rr.byName = make(map[string]*result)
+	}
+	res, found := rr.byName[name]
+	if !found {
+		res = &result{Name: name}
+		rr.byName[name] = res
+		rr.Results = append(rr.Results, res)
+	}
+	return res
+}
+
+// metric attaches a named measurement to the result of the given test.
+func (rr *runResults) metric(t *testing.T, name string, v interface{}) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	res := rr.get(t.Name())
+	if res.Metrics == nil {
+		res.Metrics = make(map[string]interface{})
+	}
+	res.Metrics[name] = v
+}
+
+// scan records a line of "go test -v" output. Log lines are attributed to the
+// test named by the latest "=== RUN", "=== CONT", "=== NAME", or "--- STATUS"
+// line as go versions differ in whether these precede or follow the log.
+func (rr *runResults) scan(line string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	trimmed := strings.TrimSpace(line)
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "===":
+		if len(fields) == 3 {
+			switch fields[1] {
+			case "RUN", "CONT", "NAME", "PAUSE":
+				rr.current = rr.get(fields[2])
+			}
+		}
+		return
+	case "---":
+		if len(fields) < 3 || !strings.HasSuffix(fields[1], ":") {
+			break
+		}
+		res := rr.get(fields[2])
+		res.Status = strings.ToLower(strings.TrimSuffix(fields[1], ":"))
+		if len(fields) > 3 {
+			s := strings.Trim(fields[3], "()")
+			res.Duration, _ = time.ParseDuration(s)
+		}
+		rr.current = res
+		return
+	}
+	if rr.current == nil || len(line) == len(trimmed) {
+		// only indented lines are test logs
+		return
+	}
+	if i := strings.Index(fields[0], ".go:"); i > 0 &&
+		strings.HasSuffix(fields[0], ":") {
+		msg := strings.TrimSpace(strings.TrimPrefix(trimmed, fields[0]))
+		rr.current.Comments = append(rr.current.Comments, msg)
+	} else if n := len(rr.current.Comments); n > 0 {
+		// continuation of a multi-line log
+		rr.current.Comments[n-1] += "\n" + trimmed
+	}
+}
+
+// finish fills the header and the failures of each failed step. Go doesn't
+// distinguish error logs from comments, nor is the last log necessarily the
+// error, e.g. that of a t.Error followed by more logs, so the failures of a
+// failed step are all the logs attributed to it by scan, i.e. its "--- FAIL"
+// block; a step failed only by its subtests has none.
+func (rr *runResults) finish() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.Header.Goes = *Goes
+	rr.Header.Buildid, _ = goesBuildid()
+	rr.Header.Driver, rr.Header.Srcversion, _ =
+		moduleSrcversion(*PlatformDriver)
+	rr.Header.XethStats, _ = xethStats()
+	rr.Manifest = getManifest()
+	for _, res := range rr.Results {
+		res.Seconds = res.Duration.Seconds()
+		if len(res.Status) == 0 {
+			// interrupted by panic or timeout
+			res.Status = "fail"
+		}
+		if res.Status == "fail" {
+			res.Failures = res.Comments
+			res.Comments = nil
+		}
+	}
+}
+
+func (rr *runResults) setTelemetry(samples []telemetrySample) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.Telemetry = samples
+}
+
+func (rr *runResults) write() {
+	rr.finish()
+	for _, x := range []struct {
+		fn  string
+		f   func() ([]byte, error)
+		ext string
+	}{
+		{*ResultsXml, rr.junit, "xml"},
+		{*ResultsJson, rr.json, "json"},
+	} {
+		if len(x.fn) == 0 {
+			continue
+		}
+		b, err := x.f()
+		if err == nil {
+			err = ioutil.WriteFile(x.fn, b, 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, x.ext, "results:", err)
+		}
+	}
+}
+
+func (rr *runResults) json() ([]byte, error) {
+	return json.MarshalIndent(rr, "", "\t")
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+func (rr *runResults) junit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      "goes-platina-mk1-blackbox",
+		Timestamp: rr.Header.Start.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{"goes", rr.Header.Goes},
+			{"buildid", rr.Header.Buildid},
+			{"driver", rr.Header.Driver},
+			{"srcversion", rr.Header.Srcversion},
+		},
+	}
+	var stats []string
+	for k := range rr.Header.XethStats {
+		stats = append(stats, k)
+	}
+	sort.Strings(stats)
+	for _, k := range stats {
+		suite.Properties = append(suite.Properties,
+			junitProperty{"xeth." + k, rr.Header.XethStats[k]})
+	}
+	if rr.Manifest != nil {
+		suite.Properties = append(suite.Properties,
+			rr.Manifest.properties()...)
+	}
+	if len(rr.Telemetry) > 0 {
+		suite.Properties = append(suite.Properties,
+			junitProperty{"telemetry.samples",
+				fmt.Sprint(len(rr.Telemetry))},
+			junitProperty{"telemetry.max_cpu_temp_c",
+				fmt.Sprint(maxCpuTemp(rr.Telemetry))})
+	}
+	var total time.Duration
+	for _, res := range rr.Results {
+		tc := junitTestCase{
+			Name:      res.Name,
+			Classname: res.Name,
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+			SystemOut: strings.Join(res.Comments, "\n"),
+		}
+		if i := strings.LastIndexByte(res.Name, '/'); i > 0 {
+			tc.Classname = res.Name[:i]
+		}
+		var metrics []string
+		for k := range res.Metrics {
+			metrics = append(metrics, k)
+		}
+		sort.Strings(metrics)
+		for _, k := range metrics {
+			b, err := json.Marshal(res.Metrics[k])
+			if err != nil {
+				return nil, err
+			}
+			tc.SystemOut += fmt.Sprint("\n", k, ": ", string(b))
+		}
+		tc.SystemOut = strings.TrimPrefix(tc.SystemOut, "\n")
+		switch res.Status {
+		case "fail":
+			msg := "subtest failed"
+			if n := len(res.Failures); n > 0 {
+				// that of t.Fatal, which ends the step
+				msg = strings.SplitN(res.Failures[n-1], "\n", 2)[0]
+			}
+			tc.Failure = &junitFailure{
+				Message: msg,
+				Text:    strings.Join(res.Failures, "\n"),
+			}
+			suite.Failures++
+		case "skip":
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		if !strings.Contains(res.Name, "/") {
+			total += res.Duration
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+	b, err := xml.MarshalIndent(suite, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
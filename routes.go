@@ -19,21 +19,27 @@ func routesVlanTest(t *testing.T) {
 	routesTest(t, "testdata/routes/vlan/conf.yaml.tmpl")
 }
 
+// Adding and deleting unrelated routes mustn't disturb H1 to H2 traffic.
+var routesStreams = []stream{
+	{"H1", "H2", "10.2.0.2"},
+	{"H1", "H2", "2001:db8:2::2"},
+}
+
 func routesTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		routesConnectivity{docket},
-		routesAdd900{docket},
+		trafficStep{routesAdd900{docket}, routesStreams, 0},
 		routesConnectivity{docket},
-		routesDel900{docket},
+		trafficStep{routesDel900{docket}, routesStreams, 0},
 		routesConnectivity{docket},
-		routesAdd1500{docket},
+		trafficStep{routesAdd1500{docket}, routesStreams, 0},
 		routesConnectivity{docket},
-		routesDel1500{docket},
+		trafficStep{routesDel1500{docket}, routesStreams, 0},
 		routesConnectivity{docket},
-		routesAdd4500{docket},
+		trafficStep{routesAdd4500{docket}, routesStreams, 0},
 		routesConnectivity{docket},
-		routesDel4500{docket},
+		trafficStep{routesDel4500{docket}, routesStreams, 0},
 		routesConnectivity{docket},
 	)
 }
@@ -6,9 +6,7 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
 	"regexp"
-	"strings"
 	"testing"
 	"time"
 
@@ -17,27 +15,29 @@ import (
 )
 
 func sliceVlanTest(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	sliceTest(t, "testdata/net/slice/vlan/conf.yaml.tmpl")
 }
 
 func sliceTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		sliceConnectivity{docket},
 		sliceFrr{docket},
 		sliceRoutes{docket},
+		fibConsistency{docket},
 		sliceInterConnectivity{docket},
 		sliceIsolation{docket},
+		offload{docket, "CB-1", "CB-2", "10.3.0.4",
+			[]string{"RB-1", "RB-2"}},
 		sliceStress{docket},
 		sliceConnectivity{docket},
 		sliceRoutes{docket},
+		fibConsistency{docket},
 		sliceInterConnectivity{docket},
 		sliceStressPci{docket},
 		sliceConnectivity{docket},
 		sliceRoutes{docket},
+		fibConsistency{docket},
 		sliceInterConnectivity{docket})
 }
 
@@ -93,8 +93,6 @@ type sliceRoutes struct{ *docker.Docket }
 func (sliceRoutes) String() string { return "routes" }
 
 func (slice sliceRoutes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	for _, x := range []struct {
 		hostname string
 		route    string
@@ -104,21 +102,17 @@ func (slice sliceRoutes) Test(t *testing.T) {
 		{"CB-1", "10.3.0.0/24"},
 		{"CB-2", "10.1.0.0/24"},
 	} {
-		found := false
-		timeout := 120
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := slice.ExecCmd(t, x.hostname,
 				"ip", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No ospf route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -220,20 +214,14 @@ func (slice sliceIsolation) Test(t *testing.T) {
 	_, err = slice.ExecCmd(t, "CA-1", "ping", "-c1", "10.3.0.4")
 	assert.NonNil(err)
 
-	ok := false
 	assert.Comment("Verify that slice B is not affected")
-	timeout := 120
-	for i := timeout; i > 0; i-- {
-		out, _ := slice.ExecCmd(t, "CB-1", "ping", "-c1", "10.3.0.4")
-		if !assert.MatchNonFatal(out, "1 received") {
-			time.Sleep(1 * time.Second)
-		} else {
-			ok = true
-			break
-		}
-	}
-	if !ok {
-		t.Error("Slice B ping failed")
+	err = eventually(120*time.Second, func() error {
+		out, _ := slice.ExecCmd(t, "CB-1",
+			"ping", "-c1", "10.3.0.4")
+		return matchErr(out, "1 received")
+	})
+	if err != nil {
+		t.Error("Slice B ping failed", err)
 	}
 	//FIXME
 	//assert.Program(regexp.MustCompile("10.3.0.0/24"),
@@ -254,166 +242,101 @@ func (slice sliceIsolation) Test(t *testing.T) {
 
 }
 
-func getCpuTemp() (val string, err error) {
-	var (
-		out    []byte
-		re     *regexp.Regexp
-		result []string
-	)
-
-	out, _ = exec.Command(*Goes, "hget", "platina-mk1", "temp").Output()
-	re, _ = regexp.Compile(`sys.cpu.coretemp.C:\s+(\d+)`)
-	result = re.FindStringSubmatch(string(out))
-	if len(result) == 2 {
-		val = result[1]
-	} else {
-		err = fmt.Errorf("temp regex failed [%v]\n", string(out))
-	}
-	return
-}
-
-func getIpv6Ll() (val string, err error) {
-	var (
-		out    []byte
-		re     *regexp.Regexp
-		result []string
-	)
-
-	out, _ = exec.Command(*Goes, "mac-ll").Output()
-	re, _ = regexp.Compile(`IPv6 link-local:\s+([a-f0-9:]+)`)
-	result = re.FindStringSubmatch(string(out))
-	if len(result) == 2 {
-		val = result[1] + "%eth0" // TODO fix non eth0 management
-	} else {
-		err = fmt.Errorf("mac-ll regex failed [%v]\n", string(out))
-	}
-
-	return
-}
-
-func getFanRpm() (rpm string, err error) {
-	var (
-		out     []byte
-		lladdr6 string
-	)
-
-	lladdr6, _ = getIpv6Ll()
-
-	out, _ = exec.Command("redis-cli", "--raw", "-h", lladdr6, "hget", "platina-mk1-bmc",
-		"fan_tray.1.1.speed.units.rpm").Output()
-	rpm = string(out)
-	rpm = strings.TrimSuffix(rpm, "\n")
-
-	return
-}
-
 type sliceStress struct{ *docker.Docket }
 
 func (sliceStress) String() string { return "stress" }
 
+func (sliceStress) Tags() []string { return []string{"stress", "long"} }
+
 func (slice sliceStress) Test(t *testing.T) {
 	assert := test.Assert{t}
 
-	assert.Comment("stress with hping3")
-
-	// 1st check temp and fan speed
-	// and compare at the end
-	var (
-		temp [6]string
-		rpm  [6]string
-		err  error
-	)
+	assert.Comment("stress with icmp flood")
 
-	temp[0], err = getCpuTemp()
-	assert.Nil(err)
-	rpm[0], err = getFanRpm()
-	assert.Nil(err)
+	defer telemetry.stress(t)()
 
-	duration := []string{"1", "10", "30", "60"}
+	duration := []time.Duration{1 * time.Second, 10 * time.Second,
+		30 * time.Second, 60 * time.Second}
 
-	ok := false
-	timeout := 120
-	for i := timeout; i > 0; i-- {
-		out, _ := slice.ExecCmd(t, "CB-1", "ping", "-c1", "10.3.0.4")
-		if !assert.MatchNonFatal(out, "1 received") {
-			time.Sleep(1 * time.Second)
-		} else {
-			ok = true
-			assert.Comment("ping ok before stress")
-			break
-		}
-	}
-	if !ok {
-		t.Error("ping failing before stress test")
+	err := eventually(120*time.Second, func() error {
+		out, _ := slice.ExecCmd(t, "CB-1",
+			"ping", "-c1", "10.3.0.4")
+		return matchErr(out, "1 received")
+	})
+	if err != nil {
+		t.Error("ping failing before stress test", err)
+	} else {
+		assert.Comment("ping ok before stress")
 	}
 
-	for i, to := range duration {
+	for _, to := range duration {
 		assert.Comment("stress for", to)
-		_, err := slice.ExecCmd(t, "CB-1",
-			"timeout", "-s", "KILL", to,
-			"hping3", "--icmp", "--flood", "-q", "10.3.0.4")
+		sliceFlood(t, trafgen{
+			Netns:    "CB-1",
+			Dst:      "10.3.0.4",
+			Proto:    trafgenICMP,
+			Rate:     *FloodRate,
+			Duration: to,
+		})
 		assert.Comment("verfy can still ping neighbor")
 		_, err = slice.ExecCmd(t, "CB-1", "ping", "-c1", "10.1.0.2")
 		if err != nil {
-			assert.Comment("hping3 failed ", to)
+			assert.Comment("flood failed ", to)
 		}
 		assert.Nil(err)
-
-		temp[i+1], err = getCpuTemp()
-		assert.Nil(err)
-		rpm[i+1], err = getFanRpm()
-		assert.Nil(err)
 	}
+}
 
-	temp[5], err = getCpuTemp()
-	assert.Nil(err)
-	rpm[5], err = getFanRpm()
+// sliceFlood runs the generator and attaches its report to the results.
+func sliceFlood(t *testing.T, g trafgen) {
+	t.Helper()
+	assert := test.Assert{t}
+	r, err := g.Run()
 	assert.Nil(err)
-
-	assert.Commentf("Temp %vC, Fan %v before stress\n", temp[0], rpm[0])
-	for i := 0; i <= 3; i++ {
-		assert.Commentf("Temp %vC, Fan %v after %v stress\n", temp[i], rpm[i], duration[i])
-	}
-	assert.Commentf("Temp %vC, Fan %v after stress\n", temp[5], rpm[5])
+	assert.Comment(g, r)
+	results.metric(t, fmt.Sprint("flood ", g.Duration), r)
 }
 
 type sliceStressPci struct{ *docker.Docket }
 
 func (sliceStressPci) String() string { return "stress-pci" }
 
+func (sliceStressPci) Tags() []string { return []string{"stress", "long"} }
+
 func (slice sliceStressPci) Test(t *testing.T) {
 	assert := test.Assert{t}
 
-	assert.Comment("stress with hping3 with ttl=1")
+	assert.Comment("stress with icmp flood with ttl=1")
+	defer telemetry.stress(t)()
 
-	duration := []string{"1", "10", "30", "60"}
+	duration := []time.Duration{1 * time.Second, 10 * time.Second,
+		30 * time.Second, 60 * time.Second}
 
-	ok := false
-	timeout := 120
-	for i := timeout; i > 0; i-- {
-		out, _ := slice.ExecCmd(t, "CB-1", "ping", "-c1", "10.3.0.4")
-		if !assert.MatchNonFatal(out, "1 received") {
-			time.Sleep(1 * time.Second)
-		} else {
-			ok = true
-			assert.Comment("ping ok before stress")
-			break
-		}
-	}
-	if !ok {
-		t.Error("ping failing before stress test")
+	err := eventually(120*time.Second, func() error {
+		out, _ := slice.ExecCmd(t, "CB-1",
+			"ping", "-c1", "10.3.0.4")
+		return matchErr(out, "1 received")
+	})
+	if err != nil {
+		t.Error("ping failing before stress test", err)
+	} else {
+		assert.Comment("ping ok before stress")
 	}
 
 	for _, to := range duration {
 		assert.Comment("stress for", to)
-		_, err := slice.ExecCmd(t, "CB-1",
-			"timeout", "-s", "KILL", to,
-			"hping3", "--icmp", "--flood", "-q", "-t", "1",
-			"10.3.0.4")
+		sliceFlood(t, trafgen{
+			Netns:    "CB-1",
+			Dst:      "10.3.0.4",
+			Proto:    trafgenICMP,
+			Rate:     *FloodRate,
+			Duration: to,
+			TTL:      1,
+		})
 		assert.Comment("verfy can still ping neighbor")
 		_, err = slice.ExecCmd(t, "CB-1", "ping", "-c1", "10.1.0.2")
 		if err != nil {
-			assert.Comment("hping3 failed ", to)
+			assert.Comment("flood failed ", to)
 		}
 
 		assert.Nil(err)
@@ -14,27 +14,27 @@ import (
 )
 
 func sliceVlanV6Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
 	sliceV6Test(t, "testdata/net6/slice/vlan/conf.yaml.tmpl")
 }
 
 func sliceV6Test(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		sliceV6Connectivity{docket},
 		sliceV6Frr{docket},
 		sliceV6Config{docket},
 		sliceV6Neighbors{docket},
 		sliceV6Routes{docket},
+		fibConsistency{docket},
 		sliceV6InterConnectivity{docket},
 		sliceV6Isolation{docket},
 		sliceV6Connectivity{docket},
 		sliceV6Routes{docket},
+		fibConsistency{docket},
 		sliceV6InterConnectivity{docket},
 		sliceV6Connectivity{docket},
 		sliceV6Routes{docket},
+		fibConsistency{docket},
 		sliceV6InterConnectivity{docket})
 }
 
@@ -122,10 +122,6 @@ type sliceV6Neighbors struct{ *docker.Docket }
 func (sliceV6Neighbors) String() string { return "neighbors" }
 
 func (slice sliceV6Neighbors) Test(t *testing.T) {
-	assert := test.Assert{t}
-
-	timeout := 120
-
 	for _, x := range []struct {
 		hostname string
 		peer     string
@@ -144,20 +140,17 @@ func (slice sliceV6Neighbors) Test(t *testing.T) {
 		{"RB-2", "0.0.0.4"},
 		{"CB-2", "0.0.0.3"},
 	} {
-		found := false
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := slice.ExecCmd(t, x.hostname,
 				"vtysh", "-c", "show ipv6 ospf6 neighbor")
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.peer) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf neighbor found for %v peer %v", x.hostname, x.peer)
+			return matchErr(out, x.peer)
+		})
+		if err != nil {
+			t.Fatalf("No ospf neighbor found for %v peer %v: %v",
+				x.hostname, x.peer, err)
 		}
 	}
 }
@@ -167,8 +160,6 @@ type sliceV6Routes struct{ *docker.Docket }
 func (sliceV6Routes) String() string { return "routes" }
 
 func (slice sliceV6Routes) Test(t *testing.T) {
-	assert := test.Assert{t}
-
 	test.Pause.Prompt("Stop")
 
 	for _, x := range []struct {
@@ -180,21 +171,17 @@ func (slice sliceV6Routes) Test(t *testing.T) {
 		{"CB-1", "2001:db8:0:3::/64"},
 		{"CB-2", "2001:db8:0:1::/64"},
 	} {
-		found := false
-		timeout := 120
-		for i := timeout; i > 0; i-- {
+		err := eventually(120*time.Second, func() error {
 			out, err := slice.ExecCmd(t, x.hostname,
 				"ip", "-6", "route", "show", x.route)
-			assert.Nil(err)
-			if !assert.MatchNonFatal(out, x.route) {
-				time.Sleep(1 * time.Second)
-			} else {
-				found = true
-				break
+			if err != nil {
+				return err
 			}
-		}
-		if !found {
-			t.Fatalf("No ospf route for %v: %v", x.hostname, x.route)
+			return matchErr(out, x.route)
+		})
+		if err != nil {
+			t.Fatalf("No ospf route for %v: %v: %v",
+				x.hostname, x.route, err)
 		}
 	}
 }
@@ -296,20 +283,14 @@ func (slice sliceV6Isolation) Test(t *testing.T) {
 	_, err = slice.ExecCmd(t, "CA-1", "ping6", "-c1", "2001:db8:0:3::4")
 	assert.NonNil(err)
 
-	ok := false
 	assert.Comment("Verify that slice B is not affected")
-	timeout := 120
-	for i := timeout; i > 0; i-- {
-		out, _ := slice.ExecCmd(t, "CB-1", "ping6", "-c1", "2001:db8:0:3::4")
-		if !assert.MatchNonFatal(out, "1 received") {
-			time.Sleep(1 * time.Second)
-		} else {
-			ok = true
-			break
-		}
-	}
-	if !ok {
-		t.Error("Slice B ping6 failed")
+	err = eventually(120*time.Second, func() error {
+		out, _ := slice.ExecCmd(t, "CB-1",
+			"ping6", "-c1", "2001:db8:0:3::4")
+		return matchErr(out, "1 received")
+	})
+	if err != nil {
+		t.Error("Slice B ping6 failed", err)
 	}
 	//FIXME
 	//assert.Program(regexp.MustCompile("2001:db8:0:3::/64"),
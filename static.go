@@ -23,12 +23,16 @@ func staticVlanTest(t *testing.T) {
 
 func staticTest(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		staticConnectivity{docket},
 		staticFrr{docket},
 		staticRoutes{docket},
+		fibConsistency{docket},
 		staticInterConnectivity{docket},
-		staticFlap{docket},
+		offload{docket, "CA-1", "CA-2", "10.3.0.4", nil},
+		trafficStep{staticFlap{docket}, []stream{
+			{"CA-1", "CA-2", "10.3.0.4"},
+		}, -1},
 		staticInterConnectivity2{docket},
 		staticPuntStress{docket},
 		staticBlackhole{docket},
@@ -135,32 +139,10 @@ type staticFlap struct{ *docker.Docket }
 
 func (staticFlap) String() string { return "flap" }
 
-func (static staticFlap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
+func (staticFlap) Tags() []string { return []string{"long"} }
 
-	for _, r := range static.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := static.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = static.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			assert.Program(*Goes, "fe1", "switch", "fib")
-		}
-	}
+func (static staticFlap) Test(t *testing.T) {
+	flapConvergence(t, static.Docket, "static", test.Ip4)
 }
 
 type staticInterConnectivity2 struct{ *docker.Docket }
@@ -199,8 +181,10 @@ type staticPuntStress struct{ *docker.Docket }
 
 func (staticPuntStress) String() string { return "punt-stress" }
 
+func (staticPuntStress) Tags() []string { return []string{"stress", "long"} }
+
 func (static staticPuntStress) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
@@ -234,8 +218,10 @@ type staticBlackhole struct{ *docker.Docket }
 
 func (staticBlackhole) String() string { return "blackhole" }
 
+func (staticBlackhole) Tags() []string { return []string{"long"} }
+
 func (static staticBlackhole) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
@@ -294,27 +280,13 @@ type staticAdminDown struct{ *docker.Docket }
 
 func (staticAdminDown) String() string { return "admin down" }
 
+func (staticAdminDown) Tags() []string { return []string{"long"} }
+
 func (static staticAdminDown) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
-	assert := test.Assert{t}
-	num_intf := 0
-	for _, r := range static.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := static.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, static.Docket, "static", test.Ip4)
 	AssertNoAdjacencies(t)
-
 }
@@ -23,10 +23,11 @@ func staticV6VlanTest(t *testing.T) {
 
 func staticV6Test(t *testing.T, tmpl string) {
 	docket := &docker.Docket{Tmpl: tmpl}
-	docket.Test(t,
+	docketTest(t, docket,
 		staticV6Connectivity{docket},
 		staticV6Frr{docket},
 		staticV6Routes{docket},
+		fibConsistency{docket},
 		staticV6InterConnectivity{docket},
 		staticV6Flap{docket},
 		staticV6InterConnectivity2{docket},
@@ -144,35 +145,10 @@ type staticV6Flap struct{ *docker.Docket }
 
 func (staticV6Flap) String() string { return "flap" }
 
-func (staticV6 staticV6Flap) Test(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
-	}
-
-	assert := test.Assert{t}
-
-	for _, r := range staticV6.Routers {
+func (staticV6Flap) Tags() []string { return []string{"long"} }
 
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := staticV6.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			_, err = staticV6.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "up", intf)
-			assert.Nil(err)
-			time.Sleep(1 * time.Second)
-			staticV6.ExecCmd(t, r.Hostname,
-				"ip", "addr", "show", "dev", intf)
-			assert.Program(*Goes, "fe1", "switch", "fib", "ip6")
-		}
-	}
+func (staticV6 staticV6Flap) Test(t *testing.T) {
+	flapConvergence(t, staticV6.Docket, "static", test.Ip6)
 }
 
 type staticV6InterConnectivity2 struct{ *docker.Docket }
@@ -211,8 +187,10 @@ type staticV6PuntStress struct{ *docker.Docket }
 
 func (staticV6PuntStress) String() string { return "punt-stress" }
 
+func (staticV6PuntStress) Tags() []string { return []string{"stress", "long"} }
+
 func (staticV6 staticV6PuntStress) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
@@ -246,8 +224,10 @@ type staticV6Blackhole struct{ *docker.Docket }
 
 func (staticV6Blackhole) String() string { return "blackhole" }
 
+func (staticV6Blackhole) Tags() []string { return []string{"long"} }
+
 func (staticV6 staticV6Blackhole) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
@@ -313,27 +293,13 @@ type staticV6AdminDown struct{ *docker.Docket }
 
 func (staticV6AdminDown) String() string { return "admin down" }
 
+func (staticV6AdminDown) Tags() []string { return []string{"long"} }
+
 func (staticV6 staticV6AdminDown) Test(t *testing.T) {
-	if testing.Short() || *test.DryRun {
+	if *test.DryRun {
 		t.SkipNow()
 	}
 
-	assert := test.Assert{t}
-	num_intf := 0
-	for _, r := range staticV6.Routers {
-		for _, i := range r.Intfs {
-			var intf string
-			if i.Vlan != "" {
-				intf = i.Name + "." + i.Vlan
-			} else {
-				intf = i.Name
-			}
-			_, err := staticV6.ExecCmd(t, r.Hostname,
-				"ip", "link", "set", "down", intf)
-			assert.Nil(err)
-			num_intf++
-		}
-	}
+	adminDownConvergence(t, staticV6.Docket, "static", test.Ip6)
 	AssertNoAdjacencies(t)
-
 }
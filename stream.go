@@ -0,0 +1,213 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/test"
+)
+
+var StreamInterval = flag.Duration("test.stream-interval", time.Millisecond,
+	"interval of background stream datagrams")
+
+// Datagrams still in flight this long after the last is sent are lost.
+const streamDrain = 500 * time.Millisecond
+
+// stream is a background flow of sequence numbered UDP datagrams from the
+// Src netns to Addr in the Dst netns.
+type stream struct {
+	Src, Dst string
+	Addr     string
+}
+
+func (s stream) String() string {
+	return fmt.Sprint(s.Src, "->", s.Dst, "[", s.Addr, "]")
+}
+
+// streamReport summarizes the datagrams received by a stream. The longest
+// outage is that of consecutively lost datagrams.
+type streamReport struct {
+	Sent          int           `json:"sent"`
+	Received      int           `json:"received"`
+	Lost          int           `json:"lost"`
+	Reordered     int           `json:"reordered"`
+	Duplicates    int           `json:"duplicates"`
+	LongestOutage time.Duration `json:"longest_outage_ns"`
+}
+
+func (r streamReport) String() string {
+	return fmt.Sprintf("sent %d received %d lost %d reordered %d "+
+		"duplicates %d longest outage %v", r.Sent, r.Received, r.Lost,
+		r.Reordered, r.Duplicates, r.LongestOutage)
+}
+
+// runningStream is a started stream that's stopped for its report.
+type runningStream struct {
+	stream
+	interval time.Duration
+	tx       net.Conn
+	rxpc     net.PacketConn
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	sent     int
+	received []int
+	reorder  int
+}
+
+func (s stream) start() (*runningStream, error) {
+	rs := &runningStream{
+		stream:   s,
+		interval: *StreamInterval,
+		stop:     make(chan struct{}),
+	}
+	err := inNetns(s.Dst, func() (err error) {
+		rs.rxpc, err = net.ListenPacket("udp", ":0")
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	port := rs.rxpc.LocalAddr().(*net.UDPAddr).Port
+	err = inNetns(s.Src, func() (err error) {
+		rs.tx, err = net.Dial("udp",
+			net.JoinHostPort(s.Addr, fmt.Sprint(port)))
+		return
+	})
+	if err != nil {
+		rs.rxpc.Close()
+		return nil, err
+	}
+	rs.wg.Add(2)
+	go rs.receive()
+	go rs.send()
+	return rs, nil
+}
+
+func (rs *runningStream) send() {
+	defer rs.wg.Done()
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	buf := make([]byte, 8)
+	for seq := 0; ; seq++ {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+		}
+		binary.BigEndian.PutUint64(buf, uint64(seq))
+		// lost datagrams are the point, so ignore send errors
+		rs.tx.Write(buf)
+		rs.mu.Lock()
+		rs.sent = seq + 1
+		rs.mu.Unlock()
+	}
+}
+
+func (rs *runningStream) receive() {
+	defer rs.wg.Done()
+	buf := make([]byte, 64)
+	last := -1
+	for {
+		n, _, err := rs.rxpc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 8 {
+			continue
+		}
+		seq := int(binary.BigEndian.Uint64(buf))
+		rs.mu.Lock()
+		if seq < last {
+			rs.reorder++
+		} else {
+			last = seq
+		}
+		rs.received = append(rs.received, seq)
+		rs.mu.Unlock()
+	}
+}
+
+// Stop the stream and report what was received.
+func (rs *runningStream) Stop() streamReport {
+	close(rs.stop)
+	time.Sleep(streamDrain)
+	rs.tx.Close()
+	rs.rxpc.Close()
+	rs.wg.Wait()
+	r := streamReport{
+		Sent:      rs.sent,
+		Received:  len(rs.received),
+		Reordered: rs.reorder,
+	}
+	seen := make([]bool, rs.sent)
+	for _, seq := range rs.received {
+		if seq >= len(seen) {
+			continue
+		}
+		if seen[seq] {
+			r.Duplicates++
+		}
+		seen[seq] = true
+	}
+	run, longest := 0, 0
+	for _, ok := range seen {
+		if ok {
+			run = 0
+			continue
+		}
+		r.Lost++
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	r.LongestOutage = time.Duration(longest) * rs.interval
+	return r
+}
+
+// trafficStep runs a step with background streams and fails if any of these
+// loses more than MaxLoss datagrams. A negative MaxLoss only reports.
+type trafficStep struct {
+	test.Tester
+	Streams []stream
+	MaxLoss int
+}
+
+func (step trafficStep) Tags() []string { return stepTags(step.Tester) }
+
+func (step trafficStep) Test(t *testing.T) {
+	var running []*runningStream
+	for _, s := range step.Streams {
+		rs, err := s.start()
+		if err != nil && step.MaxLoss >= 0 {
+			t.Error("stream", s, err)
+			continue
+		} else if err != nil {
+			t.Log("stream", s, err)
+			continue
+		}
+		running = append(running, rs)
+	}
+	defer func() {
+		for _, rs := range running {
+			r := rs.Stop()
+			test.Assert{t}.Comment(rs.stream, r)
+			results.metric(t, "stream "+rs.stream.String(), r)
+			if step.MaxLoss >= 0 && r.Lost > step.MaxLoss {
+				t.Errorf("%v lost %d datagrams, more than %d",
+					rs.stream, r.Lost, step.MaxLoss)
+			}
+		}
+	}()
+	step.Tester.Test(t)
+}
@@ -0,0 +1,280 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/test/netport"
+)
+
+var Sweep = flag.Bool("test.sweep", false,
+	"remove the containers, netns, and links left by an earlier run, then exit")
+
+// sweepNetDevs are the netport configurations whose netns and dummies the
+// suites create.
+var sweepNetDevs = []netport.NetDevs{
+	netport.OneNet,
+	netport.OneNetIp6,
+	netport.TwoNets,
+	netport.TwoNetsIp6,
+	netport.TwoVlanNets,
+	netport.TwoVlanIp6,
+	netport.BridgeNets0,
+	netport.BridgeNets1,
+	netport.BridgeNets1u,
+	netport.FourNets,
+	netport.FourNetsIp6,
+}
+
+// sweeper has the names of what the suites may leave behind.
+type sweeper struct {
+	ports      map[string]bool
+	netns      map[string]bool
+	containers map[string]bool
+	links      map[string]bool // vlans and dummies
+	changes    int
+	ecode      int
+}
+
+// sweep restores the switch to its state before any run: the ports of the
+// blackbox netns and containers are moved back to the default netns, and
+// their vlans and dummies, the containers, and the netns are removed. It
+// reports each change and returns the exit code, 1 if any failed.
+func sweep() int {
+	portByNetPort, err := netportMap()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	netport.PortByNetPort = portByNetPort
+	sw := &sweeper{
+		ports:      make(map[string]bool),
+		netns:      make(map[string]bool),
+		containers: make(map[string]bool),
+		links:      make(map[string]bool),
+	}
+	for _, port := range portByNetPort {
+		sw.ports[port] = true
+	}
+	for _, netdevs := range sweepNetDevs {
+		for _, nd := range netdevs {
+			sw.netns[nd.Netns] = true
+			for _, dIf := range nd.DummyIfs {
+				sw.links[dIf.Ifname] = true
+			}
+		}
+	}
+	err = filepath.Walk("testdata", func(path string, fi os.FileInfo,
+		err error) error {
+		if err != nil || fi.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return err
+		}
+		config, err := tmplConfig(path)
+		if err != nil {
+			return err
+		}
+		for _, r := range config.Routers {
+			sw.containers[r.Hostname] = true
+			sw.netns[r.Hostname] = true
+			for _, intf := range r.Intfs {
+				switch {
+				case intf.Vlan != "":
+					sw.links[intf.Name+"."+intf.Vlan] = true
+				case strings.Contains(intf.Name, "dummy"):
+					sw.links[intf.Name] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, ns := range sw.existingNetns() {
+		sw.sweepNetns(ns)
+	}
+	sw.sweepContainers()
+	for _, ns := range sw.existingNetns() {
+		sw.delNetns(ns)
+	}
+	sw.sweepDefault()
+	if sw.changes == 0 && sw.ecode == 0 {
+		fmt.Println("nothing to sweep")
+	}
+	return sw.ecode
+}
+
+// change runs the command that makes the described change and reports it.
+func (sw *sweeper) change(what string, args ...string) {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		fmt.Printf("%s: %v: %s\n", what, err,
+			strings.TrimSpace(string(out)))
+		sw.ecode = 1
+		return
+	}
+	sw.changes++
+	fmt.Println(what)
+}
+
+// existingNetns returns the blackbox netns in /var/run/netns.
+func (sw *sweeper) existingNetns() []string {
+	entries, err := filepath.Glob("/var/run/netns/*")
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for _, entry := range entries {
+		if ns := filepath.Base(entry); sw.netns[ns] {
+			list = append(list, ns)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// sweepNetns deletes the vlans, dummies, and bridges of the netns then moves
+// its ports back to the default netns.
+func (sw *sweeper) sweepNetns(ns string) {
+	links, err := nsLinks(ns)
+	if err != nil {
+		fmt.Println(ns, err)
+		sw.ecode = 1
+		return
+	}
+	var ports []string
+	for _, link := range links {
+		switch {
+		case link.name == "lo":
+		case sw.isPort(link.name):
+			ports = append(ports, link.name)
+		case sw.links[link.name] || link.kind == "vlan" ||
+			link.kind == "dummy" || strings.HasPrefix(link.kind,
+			"xeth-"):
+			sw.change("deleted "+link.name+" in "+ns,
+				"ip", "-n", ns, "link", "del", link.name)
+		}
+	}
+	for _, port := range ports {
+		sw.change("moved "+port+" from "+ns+" to default",
+			"ip", "-n", ns, "link", "set", port, "netns", "1")
+		sw.change("set "+port+" up", "ip", "link", "set", port, "up")
+	}
+}
+
+// sweepContainers removes the containers named by the testdata templates.
+func (sw *sweeper) sweepContainers() {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return
+	}
+	out, err := exec.Command("docker", "ps", "-a", "--format",
+		"{{.Names}}").Output()
+	if err != nil {
+		fmt.Println("docker ps:", err)
+		sw.ecode = 1
+		return
+	}
+	for _, name := range strings.Fields(string(out)) {
+		if sw.containers[name] {
+			sw.change("removed container "+name,
+				"docker", "rm", "-f", name)
+		}
+	}
+}
+
+// delNetns removes the netns, or the link to that of a container.
+func (sw *sweeper) delNetns(ns string) {
+	fn := filepath.Join("/var/run/netns", ns)
+	fi, err := os.Lstat(fn)
+	if err != nil {
+		return
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		sw.change("removed netns link "+ns, "rm", "-f", fn)
+		return
+	}
+	sw.change("deleted netns "+ns, "ip", "netns", "del", ns)
+}
+
+// sweepDefault deletes the vlans and dummies of the templates and netport
+// configurations that were left in the default netns.
+func (sw *sweeper) sweepDefault() {
+	var names []string
+	for name := range sw.links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := os.Stat(filepath.Join("/sys/class/net", name))
+		if err == nil {
+			sw.change("deleted "+name, "ip", "link", "del", name)
+		}
+	}
+	var ports []string
+	for port := range sw.ports {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return portLess(ports[i], ports[j])
+	})
+	for _, port := range ports {
+		if up, err := linkAdminUp(port); err == nil && !up {
+			sw.change("set "+port+" up", "ip", "link", "set", port,
+				"up")
+		}
+	}
+}
+
+// isPort is true of the netport.yaml interfaces and any other xeth port.
+func (sw *sweeper) isPort(name string) bool {
+	return sw.ports[name] ||
+		strings.HasPrefix(name, "xeth") && !strings.Contains(name, ".")
+}
+
+type nsLink struct {
+	name, kind string
+}
+
+// nsLinks returns the links of the netns with their kind.
+func nsLinks(ns string) ([]nsLink, error) {
+	out, err := exec.Command("ip", "-n", ns, "-d", "-o", "link",
+		"show").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ip link: %v", err)
+	}
+	var links []nsLink
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], ":")
+		if i := strings.Index(name, "@"); i > 0 {
+			name = name[:i]
+		}
+		link := nsLink{name: name}
+		for i, field := range fields {
+			if field == "\\" && i+1 < len(fields) {
+				if kind := fields[i+1]; kind == "vlan" ||
+					kind == "dummy" || strings.HasPrefix(kind,
+					"xeth") || kind == "veth" {
+					link.kind = kind
+					break
+				}
+			}
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
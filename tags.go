@@ -0,0 +1,248 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/test"
+)
+
+var (
+	Tags = flag.String("test.tags", "",
+		"comma separated tags of the tests to run, !tag to skip those")
+	ListTags = flag.Bool("test.list-tags", false,
+		"list the tests that would run, and why others would be skipped")
+)
+
+// suiteTags are the tags of the groups matching each pattern of the test
+// path, less its leading "Test/", and of everything below these.
+var suiteTags = map[string][]string{
+	"net4":          {"ipv4"},
+	"vlan4":         {"ipv4", "vlan"},
+	"bridge":        {"ipv4", "bridge"},
+	"nsif/ip4":      {"ipv4"},
+	"nsif/ip6":      {"ipv6"},
+	"net6":          {"ipv6"},
+	"vlan6":         {"ipv6", "vlan"},
+	"multipath/ip4": {"ipv4"},
+	"multipath/ip6": {"ipv6"},
+	"routes":        {"ipv4", "ipv6"},
+	"platform":      {"platform"},
+	"*/dhcp":        {"long"},
+	"*/gobgp":       {"long"},
+	"*/bird":        {"long"},
+	"*/slice":       {"long"},
+}
+
+// stepOnlyTags may be declared by steps in any group.
+var stepOnlyTags = []string{"stress", "long", "needs-docker-image"}
+
+var knownTags = []string{
+	"ipv4", "ipv6", "vlan", "bridge", "platform",
+	"stress", "long", "needs-docker-image",
+}
+
+// A tagger is a step with tags in addition to those of its groups.
+type tagger interface {
+	Tags() []string
+}
+
+func stepTags(v test.Tester) []string {
+	if tg, ok := v.(tagger); ok {
+		return tg.Tags()
+	}
+	return nil
+}
+
+// tagStep skips the wrapped step unless its tags, with those of its groups,
+// are selected by -test.tags. The tags are those of the innermost step since
+// the wrappers hide its methods.
+type tagStep struct {
+	test.Tester
+	tags []string
+}
+
+// tagged wraps the given step with its own and the extra tags.
+func tagged(v test.Tester, extra ...string) tagStep {
+	return tagStep{v, append(stepTags(v), extra...)}
+}
+
+func (step tagStep) Tags() []string { return step.tags }
+
+func (step tagStep) Test(t *testing.T) {
+	recordStep(t)
+	if reason := step.skipReason(t.Name()); len(reason) > 0 {
+		t.Skip(reason)
+	}
+	step.Tester.Test(t)
+}
+
+func (step tagStep) skipReason(name string) string {
+	return stepSkipReason(append(pathTags(name, false), step.tags...))
+}
+
+// checkTags returns an error for a -test.tags that isn't known.
+func checkTags() error {
+	want, skip := parseTags()
+	for _, tag := range append(want, skip...) {
+		if !contains(knownTags, tag) {
+			return fmt.Errorf("-test.tags: unknown %q", tag)
+		}
+	}
+	return nil
+}
+
+// parseTags returns the selected and excluded tags of -test.tags, where
+// -test.short excludes long.
+func parseTags() (want, skip []string) {
+	for _, tag := range strings.Split(*Tags, ",") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case len(tag) == 0:
+		case strings.HasPrefix(tag, "!"):
+			skip = append(skip, tag[1:])
+		default:
+			want = append(want, tag)
+		}
+	}
+	if testing.Short() && !contains(skip, "long") {
+		skip = append(skip, "long")
+	}
+	return
+}
+
+// pathTags returns the tags of the named test and its groups; with
+// descendants, it also has those that may be declared below.
+func pathTags(name string, descendants bool) []string {
+	elems := strings.Split(strings.TrimPrefix(name, "Test/"), "/")
+	found := make(map[string]struct{})
+	for pattern, tags := range suiteTags {
+		pelems := strings.Split(pattern, "/")
+		if len(pelems) > len(elems) && !descendants {
+			continue
+		}
+		matched := true
+		for i := 0; i < len(pelems) && i < len(elems); i++ {
+			if ok, _ := path.Match(pelems[i], elems[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			for _, tag := range tags {
+				found[tag] = struct{}{}
+			}
+		}
+	}
+	var tags []string
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// stepSkipReason returns why a step with the given tags, including those of
+// its groups, is skipped, or "" if it should run.
+func stepSkipReason(tags []string) string {
+	if reason := excludeReason(tags); len(reason) > 0 {
+		return reason
+	}
+	return selectReason(tags, true)
+}
+
+// groupSkipReason returns why the named group is skipped, or "" if it
+// should run. Unlike a step, a group is only unselected if neither it nor
+// anything below it may have a selected tag.
+func groupSkipReason(name string) string {
+	if reason := excludeReason(pathTags(name, false)); len(reason) > 0 {
+		return reason
+	}
+	return selectReason(pathTags(name, true), false)
+}
+
+func excludeReason(tags []string) string {
+	_, skip := parseTags()
+	for _, tag := range skip {
+		if contains(tags, tag) {
+			if tag == "long" && testing.Short() {
+				return "-test.short excludes long"
+			}
+			return "-test.tags excludes " + tag
+		}
+	}
+	return ""
+}
+
+func selectReason(tags []string, step bool) string {
+	want, _ := parseTags()
+	if len(want) == 0 {
+		return ""
+	}
+	for _, tag := range want {
+		if contains(tags, tag) {
+			return ""
+		}
+		if !step && contains(stepOnlyTags, tag) {
+			return ""
+		}
+	}
+	return "not tagged " + strings.Join(want, " or ")
+}
+
+// skipGroup skips the group, and with -test.list-tags, lists it as such.
+func skipGroup(t *testing.T, reason string) {
+	t.Helper()
+	listTest(t.Name(), pathTags(t.Name(), false), reason)
+	t.Skip(reason)
+}
+
+// listSteps, with -test.list-tags, lists whether each of the given steps
+// would run, and if not, why. It returns false if not listing.
+func listSteps(t *testing.T, tests ...test.Tester) bool {
+	if !*ListTags {
+		return false
+	}
+	for _, v := range tests {
+		name := stepName(t, v)
+		step, ok := v.(tagStep)
+		if !ok {
+			step = tagged(v)
+		}
+		tags := append(pathTags(name, false), step.tags...)
+		listTest(name, tags, step.skipReason(name))
+	}
+	return true
+}
+
+// stepName is the name of the step's subtest.
+func stepName(t *testing.T, v test.Tester) string {
+	return t.Name() + "/" + strings.Replace(v.String(), " ", "_", -1)
+}
+
+func listTest(name string, tags []string, reason string) {
+	if !*ListTags {
+		return
+	}
+	var sorted []string
+	for _, tag := range tags {
+		if !contains(sorted, tag) {
+			sorted = append(sorted, tag)
+		}
+	}
+	sort.Strings(sorted)
+	tags = sorted
+	if len(reason) > 0 {
+		fmt.Printf("SKIP %s %v: %s\n", name, tags, reason)
+	} else {
+		fmt.Printf("RUN  %s %v\n", name, tags)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/bmc"
+	"github.com/platinasystems/test"
+)
+
+var (
+	TelemetryInterval = flag.Duration("test.telemetry-interval",
+		10*time.Second,
+		"interval of temperature, fan, and PSU samples, 0 to disable")
+	MaxCpuTemp = flag.Float64("test.max-cpu-temp", 95,
+		"fail stress steps if CPU coretemp exceeds this (C), 0 for no limit")
+)
+
+// telemetrySample is the CPU coretemp of the switch with the fan tray
+// speeds, PSU status, and temperatures of its BMC.
+type telemetrySample struct {
+	Time     time.Time          `json:"time"`
+	CpuTemp  float64            `json:"cpu_temp_c,omitempty"`
+	Fans     []bmc.FanTray      `json:"fan_trays,omitempty"`
+	Psus     []bmc.Psu          `json:"psus,omitempty"`
+	BmcTemps map[string]float64 `json:"bmc_temp_c,omitempty"`
+	Errors   []string           `json:"errors,omitempty"`
+}
+
+func (s telemetrySample) String() string {
+	var fans []string
+	for _, tray := range s.Fans {
+		fans = append(fans, fmt.Sprint(tray.Tray, " ", tray.RPM))
+	}
+	return fmt.Sprintf("cpu %vC fans [%s]", s.CpuTemp,
+		strings.Join(fans, ", "))
+}
+
+// telemetrySampler records samples for the whole run, in the background at
+// -test.telemetry-interval and at the beginning and end of stress steps.
+type telemetrySampler struct {
+	mu       sync.Mutex
+	samples  []telemetrySample
+	stressed map[*testing.T]struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var telemetry telemetrySampler
+
+func (ts *telemetrySampler) start() {
+	if *TelemetryInterval <= 0 {
+		return
+	}
+	ts.stop = make(chan struct{})
+	ts.done = make(chan struct{})
+	go func() {
+		defer close(ts.done)
+		ticker := time.NewTicker(*TelemetryInterval)
+		defer ticker.Stop()
+		for {
+			ts.sample()
+			select {
+			case <-ts.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the background sampler and return the series.
+func (ts *telemetrySampler) Stop() []telemetrySample {
+	if ts.stop != nil {
+		close(ts.stop)
+		<-ts.done
+		ts.stop = nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.samples
+}
+
+// sample records the current telemetry and fails each step in stress if the
+// CPU is hotter than -test.max-cpu-temp.
+func (ts *telemetrySampler) sample() telemetrySample {
+	s := telemetrySample{Time: time.Now()}
+	var err error
+	if s.CpuTemp, err = getCpuTemp(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if err = s.sampleBmc(); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.samples = append(ts.samples, s)
+	if *MaxCpuTemp > 0 && s.CpuTemp > *MaxCpuTemp {
+		for t := range ts.stressed {
+			t.Errorf("CPU %vC exceeds %vC at %s", s.CpuTemp,
+				*MaxCpuTemp, s.Time.Format(time.StampMilli))
+		}
+	}
+	return s
+}
+
+// stress marks the given step as stressing the switch until the returned
+// function is called.
+func (ts *telemetrySampler) stress(t *testing.T) func() {
+	if *test.DryRun {
+		return func() {}
+	}
+	ts.mu.Lock()
+	if ts.stressed == nil {
+		ts.stressed = make(map[*testing.T]struct{})
+	}
+	ts.stressed[t] = struct{}{}
+	ts.mu.Unlock()
+	test.Assert{t}.Comment("before stress", ts.sample())
+	return func() {
+		test.Assert{t}.Comment("after stress", ts.sample())
+		ts.mu.Lock()
+		delete(ts.stressed, t)
+		ts.mu.Unlock()
+	}
+}
+
+// maxCpuTemp returns the hottest sample of the series.
+func maxCpuTemp(samples []telemetrySample) float64 {
+	var max float64
+	for _, s := range samples {
+		if s.CpuTemp > max {
+			max = s.CpuTemp
+		}
+	}
+	return max
+}
+
+var cpuTempRe = regexp.MustCompile(`sys.cpu.coretemp.C:\s+([0-9.]+)`)
+
+func getCpuTemp() (float64, error) {
+	out, err := exec.Command(*Goes, "hget", "platina-mk1", "temp").Output()
+	if err != nil {
+		return 0, fmt.Errorf("hget temp: %v", err)
+	}
+	result := cpuTempRe.FindStringSubmatch(string(out))
+	if len(result) != 2 {
+		return 0, fmt.Errorf("temp regex failed [%v]", string(out))
+	}
+	return strconv.ParseFloat(result[1], 64)
+}
+
+var bmcClient struct {
+	sync.Mutex
+	*bmc.Client
+}
+
+// getBmc returns the client of the BMC named by goes mac-ll.
+func getBmc() (*bmc.Client, error) {
+	bmcClient.Lock()
+	defer bmcClient.Unlock()
+	if bmcClient.Client == nil {
+		out, err := exec.Command(*Goes, "mac-ll").Output()
+		if err != nil {
+			return nil, fmt.Errorf("mac-ll: %v", err)
+		}
+		if bmcClient.Client, err = bmc.Discover(string(out)); err != nil {
+			return nil, err
+		}
+	}
+	return bmcClient.Client, nil
+}
+
+// sampleBmc fills the sample's fan trays, PSUs, and temperatures from a
+// single read of the BMC hash.
+func (s *telemetrySample) sampleBmc() error {
+	c, err := getBmc()
+	if err != nil {
+		return err
+	}
+	m, err := c.Hgetall()
+	if err != nil {
+		return fmt.Errorf("bmc: %v", err)
+	}
+	if s.Fans, err = bmc.FanTrays(m); err != nil {
+		return err
+	}
+	if s.Psus, err = bmc.Psus(m); err != nil {
+		return err
+	}
+	s.BmcTemps, err = bmc.Temperatures(m)
+	return err
+}
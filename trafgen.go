@@ -0,0 +1,367 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes-platina-mk1-blackbox/trafpkt"
+)
+
+const (
+	trafgenICMP   = trafpkt.ICMP
+	trafgenUDP    = trafpkt.UDP
+	trafgenTCPSYN = trafpkt.TCPSYN
+)
+
+// Replies received this long after the last packet is sent are lost.
+const trafgenDrain = time.Second
+
+// trafgen sends a stream of probes from a netns to a destination address
+// and matches the replies, or for UDP the datagrams received by a sink in
+// the destination netns, to count loss and latency.
+//
+// ICMP probes are echo requests and ICMP errors in response to these, e.g.
+// time exceeded with a TTL of 1, are counted as such rather than lost.
+// TCP-SYN probes are matched by the SYN-ACK or RST of the destination.
+type trafgen struct {
+	Netns    string // source, "" for the default netns
+	Dst      string // destination address
+	DstNetns string // UDP sink, required for UDP
+	Proto    string // icmp, udp, or tcp-syn
+	Port     int    // UDP and TCP destination port
+	Rate     int    // packets per second, 0 for maximum
+	Duration time.Duration
+	TTL      int // 0 for the system default
+	DSCP     int
+	Size     int // IP packet size, 0 for the minimum
+}
+
+// trafgenReport summarizes a trafgen run. Latency percentiles are those of
+// the matched replies.
+type trafgenReport struct {
+	Sent     int           `json:"sent"`
+	Received int           `json:"received"`
+	Errors   int           `json:"errors"`
+	Lost     int           `json:"lost"`
+	P50      time.Duration `json:"p50_ns"`
+	P90      time.Duration `json:"p90_ns"`
+	P99      time.Duration `json:"p99_ns"`
+	Max      time.Duration `json:"max_ns"`
+}
+
+func (r trafgenReport) String() string {
+	return fmt.Sprintf("sent %d received %d errors %d lost %d "+
+		"latency p50 %v p90 %v p99 %v max %v", r.Sent, r.Received,
+		r.Errors, r.Lost, r.P50, r.P90, r.P99, r.Max)
+}
+
+func (g trafgen) String() string {
+	s := fmt.Sprint(g.Proto, " ", g.Netns, "->", g.Dst)
+	if g.TTL > 0 {
+		s += fmt.Sprint(" ttl ", g.TTL)
+	}
+	if g.Rate > 0 {
+		s += fmt.Sprint(" ", g.Rate, "pps")
+	}
+	return s
+}
+
+// trafgenRun is the state of a trafgen run shared by its sender and
+// receiver.
+type trafgenRun struct {
+	trafgen
+	probe trafpkt.Probe
+	dst   net.IP
+
+	mu        sync.Mutex
+	sentAt    [1 << 16]int64
+	sentSeq   [1 << 16]uint32
+	received  int
+	errors    int
+	latencies []time.Duration
+}
+
+// Run the generator for its duration, then wait trafgenDrain for replies.
+func (g trafgen) Run() (trafgenReport, error) {
+	var report trafgenReport
+	r := &trafgenRun{
+		trafgen: g,
+		dst:     net.ParseIP(g.Dst),
+		probe: trafpkt.Probe{
+			Proto: g.Proto,
+			ID:    uint16(rand.Uint32()),
+			Port:  g.Port,
+		},
+	}
+	if r.dst == nil {
+		return report, fmt.Errorf("%s: invalid address", g.Dst)
+	}
+	r.probe.Dst = r.dst
+	r.probe.IP6 = r.dst.To4() == nil
+	var (
+		tx, rx net.PacketConn
+		err    error
+	)
+	inSrc := func(f func() error) error {
+		if len(g.Netns) == 0 {
+			return f()
+		}
+		return inNetns(g.Netns, f)
+	}
+	err = inSrc(func() error {
+		// the source address of the route to dst
+		conn, err := net.Dial("udp", net.JoinHostPort(g.Dst, "9"))
+		if err != nil {
+			return err
+		}
+		r.probe.Src = conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+		switch g.Proto {
+		case trafgenICMP:
+			network, laddr := "ip4:icmp", "0.0.0.0"
+			if r.probe.IP6 {
+				network, laddr = "ip6:ipv6-icmp", "::"
+			}
+			tx, err = net.ListenPacket(network, laddr)
+			rx = tx
+		case trafgenTCPSYN:
+			network, laddr := "ip4:tcp", "0.0.0.0"
+			if r.probe.IP6 {
+				network, laddr = "ip6:tcp", "::"
+			}
+			tx, err = net.ListenPacket(network, laddr)
+			rx = tx
+		case trafgenUDP:
+			tx, err = net.ListenPacket("udp", ":0")
+		default:
+			err = fmt.Errorf("%q unsupported", g.Proto)
+		}
+		return err
+	})
+	if err != nil {
+		return report, err
+	}
+	defer tx.Close()
+	if err = r.setsockopts(tx); err != nil {
+		return report, err
+	}
+	if g.Proto == trafgenUDP {
+		if len(g.DstNetns) == 0 {
+			return report, errors.New("udp requires a sink netns")
+		}
+		err = inNetns(g.DstNetns, func() (err error) {
+			rx, err = net.ListenPacket("udp",
+				net.JoinHostPort("", fmt.Sprint(g.Port)))
+			return
+		})
+		if err != nil {
+			return report, err
+		}
+		defer rx.Close()
+	}
+	// at maximum rate, replies would overflow the default buffer
+	if uc, ok := rx.(interface{ SetReadBuffer(int) error }); ok {
+		uc.SetReadBuffer(8 << 20)
+	}
+	r.probe.Payload = g.Size - r.probe.HeaderLen()
+	if r.probe.Payload < trafpkt.MinPayload {
+		r.probe.Payload = trafpkt.MinPayload
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.receive(rx)
+	}()
+	report.Sent = r.send(tx)
+	time.Sleep(trafgenDrain)
+	rx.SetReadDeadline(time.Now())
+	<-done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report.Received = r.received
+	report.Errors = r.errors
+	report.Lost = report.Sent - report.Received - report.Errors
+	if report.Lost < 0 {
+		report.Lost = 0
+	}
+	sort.Slice(r.latencies, func(i, j int) bool {
+		return r.latencies[i] < r.latencies[j]
+	})
+	if n := len(r.latencies); n > 0 {
+		report.P50 = r.latencies[n*50/100]
+		report.P90 = r.latencies[n*90/100]
+		report.P99 = r.latencies[n*99/100]
+		report.Max = r.latencies[n-1]
+	}
+	return report, nil
+}
+
+func (r *trafgenRun) setsockopts(conn net.PacketConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		set := func(level, opt, v int) {
+			if serr == nil {
+				serr = syscall.SetsockoptInt(int(fd), level, opt,
+					v)
+			}
+		}
+		if r.probe.IP6 {
+			if r.TTL > 0 {
+				set(syscall.IPPROTO_IPV6,
+					syscall.IPV6_UNICAST_HOPS, r.TTL)
+			}
+			if r.DSCP > 0 {
+				set(syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS,
+					r.DSCP<<2)
+			}
+		} else {
+			if r.TTL > 0 {
+				set(syscall.IPPROTO_IP, syscall.IP_TTL, r.TTL)
+			}
+			if r.DSCP > 0 {
+				set(syscall.IPPROTO_IP, syscall.IP_TOS,
+					r.DSCP<<2)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// send probes at the configured rate for the duration and return the
+// number sent.
+func (r *trafgenRun) send(conn net.PacketConn) int {
+	var addr net.Addr = &net.IPAddr{IP: r.dst}
+	if r.Proto == trafgenUDP {
+		addr = &net.UDPAddr{IP: r.dst, Port: r.Port}
+	}
+	var interval time.Duration
+	if r.Rate > 0 {
+		interval = time.Second / time.Duration(r.Rate)
+	}
+	start := time.Now()
+	end := start.Add(r.Duration)
+	sent := 0
+	for seq := uint32(0); ; seq++ {
+		now := time.Now()
+		if now.After(end) {
+			break
+		}
+		if interval > 0 {
+			next := start.Add(time.Duration(seq) * interval)
+			if d := next.Sub(now); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		r.mu.Lock()
+		r.sentAt[seq&0xffff] = time.Now().UnixNano()
+		r.sentSeq[seq&0xffff] = seq
+		r.mu.Unlock()
+		// drops are counted by the receiver, so ignore send errors
+		if _, err := conn.WriteTo(r.probe.Packet(seq, time.Now()), addr); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (r *trafgenRun) receive(conn net.PacketConn) {
+	buf := make([]byte, 1<<16)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		b := buf[:n]
+		switch r.Proto {
+		case trafgenICMP:
+			r.receiveICMP(b, now)
+		case trafgenTCPSYN:
+			if ip := addrIP(from); ip != nil && ip.Equal(r.dst) {
+				r.receiveTCP(b, now)
+			}
+		case trafgenUDP:
+			if sent, ok := trafpkt.ParseUDP(b); ok {
+				r.match(now.Sub(sent))
+			}
+		}
+	}
+}
+
+func (r *trafgenRun) receiveICMP(b []byte, now time.Time) {
+	switch kind, sent := r.probe.ParseICMP(b); kind {
+	case trafpkt.Reply:
+		r.match(now.Sub(sent))
+	case trafpkt.Error:
+		r.mu.Lock()
+		r.errors++
+		r.mu.Unlock()
+	}
+}
+
+func (r *trafgenRun) receiveTCP(b []byte, now time.Time) {
+	seqs, ok := r.probe.ParseTCP(b)
+	if !ok {
+		return
+	}
+	for _, seq := range seqs {
+		r.mu.Lock()
+		i := seq & 0xffff
+		found := r.sentSeq[i] == seq && r.sentAt[i] != 0
+		var sent int64
+		if found {
+			sent = r.sentAt[i]
+			r.sentAt[i] = 0
+		}
+		r.mu.Unlock()
+		if found {
+			r.match(time.Duration(now.UnixNano() - sent))
+			return
+		}
+	}
+}
+
+// At most this many latencies are kept, after which these are sampled.
+const trafgenLatencies = 1 << 20
+
+func (r *trafgenRun) match(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received++
+	if len(r.latencies) < trafgenLatencies {
+		r.latencies = append(r.latencies, latency)
+	} else if i := rand.Intn(r.received); i < trafgenLatencies {
+		r.latencies[i] = latency
+	}
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package trafpkt builds the ICMP, UDP, and TCP-SYN probes of the blackbox
+// traffic generator and parses their replies.
+//
+// Each probe carries its sequence number and send time so that replies may
+// be matched without per packet state, except for TCP where the
+// destination only echoes the sequence number in its acknowledgment.
+package trafpkt
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	ICMP   = "icmp"
+	UDP    = "udp"
+	TCPSYN = "tcp-syn"
+)
+
+// MinPayload is the room for the sequence number and send time.
+const MinPayload = 12
+
+// Probe describes the probes of a run, less their sequence number.
+type Probe struct {
+	Proto   string // ICMP, UDP, or TCPSYN
+	IP6     bool
+	ID      uint16 // ICMP identifier and TCP source port seed
+	Port    int    // UDP and TCP destination port
+	Src     net.IP // TCP pseudo header source
+	Dst     net.IP // TCP pseudo header destination
+	Payload int    // bytes following the L4 header
+}
+
+// Replies classified by ParseICMP.
+const (
+	NotOurs = iota
+	Reply
+	Error
+)
+
+// HeaderLen returns the length of the IP and L4 headers of a probe.
+func (p Probe) HeaderLen() int {
+	n := 20
+	if p.IP6 {
+		n = 40
+	}
+	switch p.Proto {
+	case ICMP, UDP:
+		n += 8
+	case TCPSYN:
+		n += 20
+	}
+	return n
+}
+
+// Packet returns the L4 probe with the sequence number and send time
+// followed by padding. For UDP, this is just the datagram payload.
+func (p Probe) Packet(seq uint32, now time.Time) []byte {
+	payload := p.Payload
+	if payload < MinPayload {
+		payload = MinPayload
+	}
+	var b []byte
+	switch p.Proto {
+	case ICMP:
+		b = make([]byte, 8+payload)
+		b[0] = 8 // echo request
+		if p.IP6 {
+			b[0] = 128
+		}
+		binary.BigEndian.PutUint16(b[4:], p.ID)
+		binary.BigEndian.PutUint16(b[6:], uint16(seq))
+		binary.BigEndian.PutUint32(b[8:], seq)
+		binary.BigEndian.PutUint64(b[12:], uint64(now.UnixNano()))
+		if !p.IP6 {
+			// the kernel sums ICMPv6
+			binary.BigEndian.PutUint16(b[2:], Checksum(b, 0))
+		}
+	case TCPSYN:
+		b = make([]byte, 20+payload)
+		binary.BigEndian.PutUint16(b[0:], p.SrcPort())
+		binary.BigEndian.PutUint16(b[2:], uint16(p.Port))
+		binary.BigEndian.PutUint32(b[4:], seq)
+		b[12] = 5 << 4
+		b[13] = 0x02 // SYN
+		binary.BigEndian.PutUint16(b[14:], 65535)
+		binary.BigEndian.PutUint16(b[16:],
+			Checksum(b, p.PseudoSum(syscall.IPPROTO_TCP, len(b))))
+	case UDP:
+		b = make([]byte, payload)
+		binary.BigEndian.PutUint32(b, seq)
+		binary.BigEndian.PutUint64(b[4:], uint64(now.UnixNano()))
+	}
+	return b
+}
+
+// SrcPort is that of the TCP probes.
+func (p Probe) SrcPort() uint16 {
+	return 32768 + p.ID%16384
+}
+
+// PseudoSum returns the unfolded sum of the pseudo header of an L4 packet
+// of the given protocol and length.
+func (p Probe) PseudoSum(proto, n int) uint32 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+	}
+	if p.IP6 {
+		add(p.Src.To16())
+		add(p.Dst.To16())
+	} else {
+		add(p.Src.To4())
+		add(p.Dst.To4())
+	}
+	sum += uint32(proto) + uint32(n)
+	return sum
+}
+
+// Checksum returns the internet checksum of b with the given initial sum.
+func Checksum(b []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// ParseICMP classifies an ICMP message, without IP header, as a Reply to
+// one of the probes along with its send time, an Error quoting one of the
+// probes, e.g. time exceeded, or NotOurs.
+func (p Probe) ParseICMP(b []byte) (int, time.Time) {
+	if len(b) < 8 {
+		return NotOurs, time.Time{}
+	}
+	reply, unreachable, exceeded := byte(0), byte(3), byte(11)
+	ipHeader := 20
+	if p.IP6 {
+		reply, unreachable, exceeded = 129, 1, 3
+		ipHeader = 40
+	}
+	switch b[0] {
+	case reply:
+		if len(b) < 20 || binary.BigEndian.Uint16(b[4:]) != p.ID {
+			break
+		}
+		sent := int64(binary.BigEndian.Uint64(b[12:]))
+		return Reply, time.Unix(0, sent)
+	case unreachable, exceeded:
+		// the error quotes the probe's IP header and ICMP header
+		inner := b[8:]
+		if !p.IP6 && len(inner) > 0 {
+			ipHeader = int(inner[0]&0xf) * 4
+		}
+		if len(inner) < ipHeader+8 {
+			break
+		}
+		probe := inner[ipHeader:]
+		if binary.BigEndian.Uint16(probe[4:]) == p.ID {
+			return Error, time.Time{}
+		}
+	}
+	return NotOurs, time.Time{}
+}
+
+// ParseTCP returns the sequence numbers of the probe that a SYN-ACK or RST
+// to the probes' source port may acknowledge; a SYN-ACK acknowledges the
+// SYN, a RST also the padding.
+func (p Probe) ParseTCP(b []byte) ([]uint32, bool) {
+	if len(b) < 20 || binary.BigEndian.Uint16(b[2:]) != p.SrcPort() {
+		return nil, false
+	}
+	const syn, rst, ack = 0x02, 0x04, 0x10
+	flags := b[13]
+	if flags&ack == 0 || flags&(syn|rst) == 0 {
+		return nil, false
+	}
+	acked := binary.BigEndian.Uint32(b[8:])
+	payload := p.Payload
+	if payload < MinPayload {
+		payload = MinPayload
+	}
+	return []uint32{acked - 1, acked - 1 - uint32(payload)}, true
+}
+
+// ParseUDP returns the send time of a datagram received by the sink.
+func ParseUDP(b []byte) (time.Time, bool) {
+	if len(b) < MinPayload {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[4:]))), true
+}
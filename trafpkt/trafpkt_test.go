@@ -0,0 +1,315 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package trafpkt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sent is the send time of the probes whose bytes are given below.
+var sent = time.Unix(0, 0x0102030405060708)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestChecksum(t *testing.T) {
+	for _, x := range []struct {
+		name string
+		b    string
+		sum  uint32
+		want uint16
+	}{
+		// RFC 1071, 3. Numerical Examples
+		{"rfc1071", "0001 f203 f4f5 f6f7", 0, 0x220d},
+		{"rfc1071-folded", "0001 f203 f4f5 f6f7", 0x10000, 0x220c},
+		{"ipv4-header", `
+			4500 0073 0000 4000 4011 0000
+			c0a8 0001 c0a8 00c7`, 0, 0xb861},
+		{"ipv4-header-verify", `
+			4500 0073 0000 4000 4011 b861
+			c0a8 0001 c0a8 00c7`, 0, 0},
+		{"odd", "01", 0, 0xfeff},
+		{"odd-carry", "ffff ff", 0, 0x00ff},
+		{"empty", "", 0, 0xffff},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			got := Checksum(unhex(t, x.b), x.sum)
+			if got != x.want {
+				t.Errorf("got %#04x, want %#04x", got, x.want)
+			}
+		})
+	}
+}
+
+func TestPacket(t *testing.T) {
+	src4, dst4 := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	src6, dst6 := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	for _, x := range []struct {
+		name string
+		p    Probe
+		want string
+	}{
+		{
+			"icmp4",
+			Probe{Proto: ICMP, ID: 0x1234},
+			`0800 cead 1234 0304 0102 0304
+			0102 0304 0506 0708`,
+		},
+		{
+			"icmp6",
+			Probe{Proto: ICMP, IP6: true, ID: 0x1234},
+			`8000 0000 1234 0304 0102 0304
+			0102 0304 0506 0708`,
+		},
+		{
+			"icmp4-padded",
+			Probe{Proto: ICMP, ID: 0x1234, Payload: 16},
+			`0800 cead 1234 0304 0102 0304
+			0102 0304 0506 0708 0000 0000`,
+		},
+		{
+			"tcp4-syn",
+			Probe{Proto: TCPSYN, ID: 0x1234, Port: 80,
+				Src: src4, Dst: dst4},
+			`9234 0050 0102 0304 0000 0000 5002 ffff 054a 0000
+			0000 0000 0000 0000 0000 0000`,
+		},
+		{
+			"tcp6-syn",
+			Probe{Proto: TCPSYN, IP6: true, ID: 0x1234, Port: 80,
+				Src: src6, Dst: dst6},
+			`9234 0050 0102 0304 0000 0000 5002 ffff bdd7 0000
+			0000 0000 0000 0000 0000 0000`,
+		},
+		{
+			"udp",
+			Probe{Proto: UDP, Port: 5001},
+			"0102 0304 0102 0304 0506 0708",
+		},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			got := x.p.Packet(0x01020304, sent)
+			want := unhex(t, x.want)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestHeaderLen(t *testing.T) {
+	for _, x := range []struct {
+		p    Probe
+		want int
+	}{
+		{Probe{Proto: ICMP}, 28},
+		{Probe{Proto: UDP}, 28},
+		{Probe{Proto: TCPSYN}, 40},
+		{Probe{Proto: ICMP, IP6: true}, 48},
+		{Probe{Proto: TCPSYN, IP6: true}, 60},
+	} {
+		if got := x.p.HeaderLen(); got != x.want {
+			t.Errorf("%+v: got %d, want %d", x.p, got, x.want)
+		}
+	}
+}
+
+func TestParseICMP(t *testing.T) {
+	p4 := Probe{Proto: ICMP, ID: 0x1234}
+	p6 := Probe{Proto: ICMP, IP6: true, ID: 0x1234}
+	for _, x := range []struct {
+		name string
+		p    Probe
+		b    string
+		kind int
+	}{
+		{
+			"echo-reply",
+			p4,
+			`0000 d6ad 1234 0304 0102 0304
+			0102 0304 0506 0708`,
+			Reply,
+		},
+		{
+			"echo-reply6",
+			p6,
+			`8100 0000 1234 0304 0102 0304
+			0102 0304 0506 0708`,
+			Reply,
+		},
+		{
+			"echo-reply-other-id",
+			p4,
+			`0000 0000 4321 0304 0001 0203
+			0102 0304 0506 0708`,
+			NotOurs,
+		},
+		{
+			"echo-reply-truncated",
+			p4,
+			"0000 0000 1234 0304 0102 0304",
+			NotOurs,
+		},
+		{
+			"echo-request",
+			p4,
+			`0800 cead 1234 0304 0102 0304
+			0102 0304 0506 0708`,
+			NotOurs,
+		},
+		{
+			"time-exceeded",
+			p4,
+			`0b00 0000 0000 0000
+			4500 0028 0000 4000 0101 0000 0a00 0001 0a00 0002
+			0800 cead 1234 0304`,
+			Error,
+		},
+		{
+			"time-exceeded-options",
+			p4,
+			`0b00 0000 0000 0000
+			4600 002c 0000 4000 0101 0000 0a00 0001 0a00 0002
+			0101 0100
+			0800 cead 1234 0304`,
+			Error,
+		},
+		{
+			"unreachable",
+			p4,
+			`0303 0000 0000 0000
+			4500 0028 0000 4000 4001 0000 0a00 0001 0a00 0002
+			0800 cead 1234 0304`,
+			Error,
+		},
+		{
+			"unreachable-other-id",
+			p4,
+			`0303 0000 0000 0000
+			4500 0028 0000 4000 4001 0000 0a00 0001 0a00 0002
+			0800 cead 4321 0304`,
+			NotOurs,
+		},
+		{
+			"time-exceeded-truncated",
+			p4,
+			`0b00 0000 0000 0000
+			4500 0028 0000 4000 0101 0000 0a00 0001 0a00 0002
+			0800 cead`,
+			NotOurs,
+		},
+		{
+			"time-exceeded6",
+			p6,
+			`0300 0000 0000 0000
+			6000 0000 0014 3a01
+			2001 0db8 0000 0000 0000 0000 0000 0001
+			2001 0db8 0000 0000 0000 0000 0000 0002
+			8000 0000 1234 0304`,
+			Error,
+		},
+		{
+			"unreachable6",
+			p6,
+			`0104 0000 0000 0000
+			6000 0000 0014 3a40
+			2001 0db8 0000 0000 0000 0000 0000 0001
+			2001 0db8 0000 0000 0000 0000 0000 0002
+			8000 0000 1234 0304`,
+			Error,
+		},
+		{
+			"time-exceeded4-as-6",
+			p6,
+			`0b00 0000 0000 0000
+			4500 0028 0000 4000 0101 0000 0a00 0001 0a00 0002
+			0800 cead 1234 0304`,
+			NotOurs,
+		},
+		{"short", p4, "0000 0000", NotOurs},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			kind, at := x.p.ParseICMP(unhex(t, x.b))
+			if kind != x.kind {
+				t.Fatalf("got %d, want %d", kind, x.kind)
+			}
+			if kind == Reply && !at.Equal(sent) {
+				t.Errorf("sent at %v, want %v", at, sent)
+			}
+		})
+	}
+}
+
+func TestParseTCP(t *testing.T) {
+	p := Probe{Proto: TCPSYN, ID: 0x1234, Port: 80}
+	for _, x := range []struct {
+		name string
+		b    string
+		want []uint32
+	}{
+		{
+			"syn-ack",
+			"0050 9234 a000 0000 0102 0305 5012 ffff 0000 0000",
+			[]uint32{0x01020304, 0x010202f8},
+		},
+		{
+			"rst-ack",
+			"0050 9234 0000 0000 0102 0311 5014 0000 0000 0000",
+			[]uint32{0x01020310, 0x01020304},
+		},
+		{
+			"syn",
+			"0050 9234 a000 0000 0000 0000 5002 ffff 0000 0000",
+			nil,
+		},
+		{
+			"ack",
+			"0050 9234 a000 0000 0102 0305 5010 ffff 0000 0000",
+			nil,
+		},
+		{
+			"other-port",
+			"0050 9235 a000 0000 0102 0305 5012 ffff 0000 0000",
+			nil,
+		},
+		{
+			"truncated",
+			"0050 9234 a000 0000 0102 0305 5012",
+			nil,
+		},
+	} {
+		t.Run(x.name, func(t *testing.T) {
+			got, ok := p.ParseTCP(unhex(t, x.b))
+			if ok != (x.want != nil) {
+				t.Fatalf("got %v", ok)
+			}
+			if !reflect.DeepEqual(got, x.want) {
+				t.Errorf("got %#x, want %#x", got, x.want)
+			}
+		})
+	}
+}
+
+func TestParseUDP(t *testing.T) {
+	p := Probe{Proto: UDP}
+	at, ok := ParseUDP(p.Packet(1, sent))
+	if !ok || !at.Equal(sent) {
+		t.Errorf("got %v %v, want %v", at, ok, sent)
+	}
+	if _, ok = ParseUDP(make([]byte, MinPayload-1)); ok {
+		t.Error("parsed truncated datagram")
+	}
+}
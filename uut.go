@@ -0,0 +1,93 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const XethStatDir = "/sys/kernel/platina-mk1/xeth"
+
+// uutSockets are the abstract unix sockets of the xeth module and goes
+// daemons with a hint of what's wrong if these are missing.
+var uutSockets = []struct{ name, hint string }{
+	{"@xeth", "are modules loaded?"},
+	{"@redisd", "is goes running?"},
+	{"@redis.reg", "is goes running?"},
+	{"@redis.pub", "is goes running?"},
+	{"@fe1", "is goes running?"},
+}
+
+// checkSocket returns an error if the named socket isn't in the given
+// /proc/net/unix.
+func checkSocket(unix []byte, name, hint string) error {
+	if bytes.Index(unix, []byte(name)) < 0 {
+		return fmt.Errorf("no %s, %s", name, hint)
+	}
+	return nil
+}
+
+// goesBuildid returns the "show buildid" of the goes under test.
+func goesBuildid() (string, error) {
+	o, err := exec.Command(*Goes, "show", "buildid").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(o)), nil
+}
+
+// moduleSrcversion returns the modinfo srcversion of the named kernel module
+// or, if present, the module file in the current directory.
+func moduleSrcversion(module string) (ko, srcversion string, err error) {
+	ko = module
+	if !strings.HasSuffix(ko, ".ko") {
+		ko += ".ko"
+	}
+	if _, err = os.Stat(ko); err != nil {
+		ko = module
+	}
+	o, err := exec.Command("/sbin/modinfo", ko).Output()
+	if err != nil {
+		return
+	}
+	const key = "srcversion:"
+	s := string(o)
+	i := strings.Index(s, key)
+	if i < 0 {
+		err = fmt.Errorf("%s: no %s", ko, key)
+		return
+	}
+	s = s[i+len(key):]
+	if i = strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	srcversion = strings.TrimSpace(s)
+	return
+}
+
+// xethStats returns the non-zero counters of XethStatDir.
+func xethStats() (map[string]string, error) {
+	fis, err := ioutil.ReadDir(XethStatDir)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for _, fi := range fis {
+		bn := fi.Name()
+		b, err := ioutil.ReadFile(filepath.Join(XethStatDir, bn))
+		if err != nil {
+			stats[bn] = err.Error()
+		} else if s := strings.TrimSpace(string(b)); s != "0" {
+			stats[bn] = s
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,146 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/test"
+	"github.com/platinasystems/test/netport"
+	"gopkg.in/yaml.v2"
+)
+
+var Veth = flag.Bool("test.veth", false,
+	"create a veth pair for each netport pair instead of cabled ports")
+
+// netportPairs returns the netport.yaml interfaces of each netNport0 and
+// netNport1 pair.
+func netportPairs() ([][2]string, error) {
+	b, err := ioutil.ReadFile(netport.NetPortFile)
+	if err != nil {
+		return nil, err
+	}
+	portByNetPort := make(map[string]string)
+	if err = yaml.Unmarshal(b, portByNetPort); err != nil {
+		return nil, fmt.Errorf("%s: %v", netport.NetPortFile, err)
+	}
+	var pairs [][2]string
+	for n := 0; ; n++ {
+		port0, found0 := portByNetPort[fmt.Sprint("net", n, "port0")]
+		port1, found1 := portByNetPort[fmt.Sprint("net", n, "port1")]
+		if !found0 && !found1 {
+			break
+		}
+		if !found0 || !found1 {
+			return nil, fmt.Errorf("%s: net%d is missing a port",
+				netport.NetPortFile, n)
+		}
+		pairs = append(pairs, [2]string{port0, port1})
+	}
+	if 2*len(pairs) != len(portByNetPort) {
+		var netports []string
+		for netport := range portByNetPort {
+			netports = append(netports, netport)
+		}
+		sort.Strings(netports)
+		return nil, fmt.Errorf("%s: netports %v aren't consecutive pairs",
+			netport.NetPortFile, netports)
+	}
+	return pairs, nil
+}
+
+// addVeths creates a veth pair for each netport pair, named as in
+// netport.yaml, so that conf.yaml.tmpl and netport virtual networks render
+// to these instead of physical ports. This panics if any of these interfaces
+// already exist or, after deleting the pairs that it made, if one fails.
+func addVeths() {
+	pairs, err := netportPairs()
+	if err != nil {
+		panic(err)
+	}
+	for _, pair := range pairs {
+		for _, ifname := range pair {
+			_, err := os.Stat(filepath.Join("/sys/class/net", ifname))
+			if err == nil {
+				panic(fmt.Errorf("%s exists", ifname))
+			}
+		}
+	}
+	var made [][2]string
+	ip := func(args ...string) {
+		out, err := exec.Command("ip", args...).CombinedOutput()
+		if err != nil {
+			delVethPairs(made)
+			panic(fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "),
+				err, strings.TrimSpace(string(out))))
+		}
+	}
+	for _, pair := range pairs {
+		ip("link", "add", pair[0], "type", "veth", "peer", "name",
+			pair[1])
+		made = append(made, pair)
+		ip("link", "set", pair[0], "up")
+		ip("link", "set", pair[1], "up")
+	}
+}
+
+// delVeths removes the veth pairs wherever they are, the default netns or
+// any in /var/run/netns, e.g. those of netport virtual networks and dockets
+// that weren't torn down; deleting either end removes its peer.
+func delVeths() {
+	pairs, err := netportPairs()
+	if err != nil {
+		test.Log().Output(2, err.Error())
+		return
+	}
+	delVethPairs(pairs)
+}
+
+func delVethPairs(pairs [][2]string) {
+	netns, _ := filepath.Glob("/var/run/netns/*")
+	for _, pair := range pairs {
+		ns, ifname := findVeth(pair, netns)
+		if len(ifname) == 0 {
+			test.Log().Output(2, fmt.Sprint(pair[0], ": not found"))
+			continue
+		}
+		args := []string{"link", "del", ifname}
+		if len(ns) > 0 {
+			args = append([]string{"-n", ns}, args...)
+		}
+		if err := exec.Command("ip", args...).Run(); err != nil {
+			test.Log().Output(2, fmt.Sprint(ifname, ": ", err))
+		}
+	}
+}
+
+// findVeth returns the netns, "" for the default, and name of the first end
+// of the pair that it finds.
+func findVeth(pair [2]string, netns []string) (string, string) {
+	for _, ifname := range pair {
+		_, err := os.Stat(filepath.Join("/sys/class/net", ifname))
+		if err == nil {
+			return "", ifname
+		}
+	}
+	for _, fn := range netns {
+		ns := filepath.Base(fn)
+		for _, ifname := range pair {
+			err := exec.Command("ip", "-n", ns, "link", "show", "dev",
+				ifname).Run()
+			if err == nil {
+				return ns, ifname
+			}
+		}
+	}
+	return "", ""
+}
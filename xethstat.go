@@ -0,0 +1,168 @@
+// Copyright © 2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/platinasystems/test"
+	"gopkg.in/yaml.v2"
+)
+
+var XethThresholds = flag.String("test.xeth-thresholds",
+	"testdata/xeth_thresholds.yaml",
+	"maximum xeth stat increase of each step by suite")
+
+// xethThresholds maps suite patterns to the maximum increase of the xeth
+// stats matching each counter pattern. Suite patterns are matched against
+// the leading elements of the step path, less the top "Test", e.g.
+// "net4/frr" or "*/slice"; both are path.Match patterns.
+type xethThresholds map[string]map[string]int64
+
+var loadedXethThresholds struct {
+	once sync.Once
+	th   xethThresholds
+	err  error
+}
+
+// getXethThresholds reads -test.xeth-thresholds once; a missing file has
+// no thresholds.
+func getXethThresholds() (xethThresholds, error) {
+	l := &loadedXethThresholds
+	l.once.Do(func() {
+		b, err := ioutil.ReadFile(*XethThresholds)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			l.err = err
+			return
+		}
+		if err = yaml.Unmarshal(b, &l.th); err != nil {
+			l.err = fmt.Errorf("%s: %v", *XethThresholds, err)
+		}
+	})
+	return l.th, l.err
+}
+
+// limits returns the counter thresholds of the named step. Those of longer
+// matching suite prefixes override the same counter pattern of shorter.
+func (th xethThresholds) limits(name string) map[string]int64 {
+	elems := strings.Split(name, "/")
+	if len(elems) > 0 && elems[0] == "Test" {
+		elems = elems[1:]
+	}
+	limits := make(map[string]int64)
+	for n := 1; n <= len(elems); n++ {
+		prefix := strings.Join(elems[:n], "/")
+		var suites []string
+		for suite := range th {
+			if ok, _ := path.Match(suite, prefix); ok {
+				suites = append(suites, suite)
+			}
+		}
+		sort.Strings(suites)
+		for _, suite := range suites {
+			for counter, max := range th[suite] {
+				limits[counter] = max
+			}
+		}
+	}
+	return limits
+}
+
+// xethDeltas returns the increase of each xeth stat that changed between
+// the given xethStats.
+func xethDeltas(before, after map[string]string) map[string]int64 {
+	deltas := make(map[string]int64)
+	for name, v := range after {
+		a, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		b, _ := strconv.ParseInt(before[name], 10, 64)
+		if a != b {
+			deltas[name] = a - b
+		}
+	}
+	return deltas
+}
+
+// xethStep attaches the xeth stat deltas of a step to its result and fails
+// the step if any exceeds its -test.xeth-thresholds.
+type xethStep struct{ test.Tester }
+
+// xethSteps wraps each of the given tests with an xethStep that is skipped
+// unless selected by its tags.
+func xethSteps(tests ...test.Tester) []test.Tester {
+	steps := make([]test.Tester, len(tests))
+	for i, v := range tests {
+		steps[i] = tagStep{xethStep{v}, stepTags(v)}
+	}
+	return steps
+}
+
+func (step xethStep) Test(t *testing.T) {
+	if *test.DryRun {
+		step.Tester.Test(t)
+		return
+	}
+	before, err := xethStats()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			t.Log(err)
+		}
+		step.Tester.Test(t)
+		return
+	}
+	defer func() {
+		after, err := xethStats()
+		if err != nil {
+			t.Log(err)
+			return
+		}
+		deltas := xethDeltas(before, after)
+		if len(deltas) == 0 {
+			return
+		}
+		results.metric(t, "xeth", deltas)
+		var names []string
+		for name := range deltas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if *XethStat {
+			for _, name := range names {
+				test.Assert{t}.Commentf("xeth %s +%d", name,
+					deltas[name])
+			}
+		}
+		th, err := getXethThresholds()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		limits := th.limits(t.Name())
+		for _, name := range names {
+			for counter, max := range limits {
+				ok, _ := path.Match(counter, name)
+				if ok && deltas[name] > max {
+					t.Errorf("xeth %s +%d exceeds %s %d",
+						name, deltas[name], counter, max)
+				}
+			}
+		}
+	}()
+	step.Tester.Test(t)
+}